@@ -0,0 +1,176 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderAPIKey = "X-API-Key"
+
+	MethodAPIKey = "api_key"
+	MethodWeChat = "wechat"
+
+	defaultTokenTTL = 7 * 24 * time.Hour
+	contextKey      = "auth.user"
+)
+
+var (
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// User 当前请求的调用方
+type User struct {
+	ID     string
+	Method string // api_key, wechat
+	Admin  bool
+	Tier   string // 限流档位，为空时使用默认档位
+}
+
+// Authenticator 校验 API Key 和小程序登录后签发的 token
+type Authenticator struct {
+	apiKeys  map[string]config.APIKey // key 的 SHA-256 -> 配置
+	secret   []byte
+	tokenTTL time.Duration
+}
+
+func NewAuthenticator(cfg config.Auth) (*Authenticator, error) {
+	a := &Authenticator{
+		apiKeys:  make(map[string]config.APIKey, len(cfg.APIKeys)),
+		secret:   []byte(cfg.TokenSecret),
+		tokenTTL: cfg.TokenTTL,
+	}
+	for _, k := range cfg.APIKeys {
+		if k.KeySha256 == "" || k.UserID == "" {
+			return nil, errors.New("auth.api_keys requires key_sha256 and user_id")
+		}
+		a.apiKeys[strings.ToLower(k.KeySha256)] = k
+	}
+	if len(a.secret) == 0 {
+		// 未配置时随机生成，重启后已签发的 token 失效
+		a.secret = make([]byte, 32)
+		if _, err := rand.Read(a.secret); err != nil {
+			return nil, err
+		}
+	}
+	if a.tokenTTL <= 0 {
+		a.tokenTTL = defaultTokenTTL
+	}
+	return a, nil
+}
+
+// WeChatUserID 小程序用户的 user_id
+func WeChatUserID(openID string) string {
+	return "wx:" + openID
+}
+
+// IssueToken 为用户签发访问 token，格式为 base64(user_id|过期时间).签名
+func (a *Authenticator) IssueToken(userID string) (string, time.Time) {
+	expiresAt := time.Now().Add(a.tokenTTL).Truncate(time.Second)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(userID + "|" + strconv.FormatInt(expiresAt.Unix(), 10)))
+	return payload + "." + a.sign(payload), expiresAt
+}
+
+// VerifyToken 校验 token 并返回其中的 user_id
+func (a *Authenticator) VerifyToken(token string) (string, error) {
+	payload, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(a.sign(payload))) {
+		return "", ErrUnauthorized
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return "", ErrUnauthorized
+	}
+	i := strings.LastIndexByte(string(raw), '|')
+	if i <= 0 {
+		return "", ErrUnauthorized
+	}
+	expires, err := strconv.ParseInt(string(raw[i+1:]), 10, 64)
+	if err != nil {
+		return "", ErrUnauthorized
+	}
+	if time.Now().Unix() > expires {
+		return "", ErrTokenExpired
+	}
+	return string(raw[:i]), nil
+}
+
+func (a *Authenticator) sign(payload string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Authenticate 从请求头中识别调用方，支持 X-API-Key 和 Authorization: Bearer <token>
+func (a *Authenticator) Authenticate(r *http.Request) (*User, error) {
+	if key := r.Header.Get(HeaderAPIKey); key != "" {
+		sum := sha256.Sum256([]byte(key))
+		k, ok := a.apiKeys[hex.EncodeToString(sum[:])]
+		if !ok {
+			return nil, ErrUnauthorized
+		}
+		return &User{ID: k.UserID, Method: MethodAPIKey, Admin: k.Admin, Tier: k.Tier}, nil
+	}
+
+	scheme, token, ok := strings.Cut(r.Header.Get(echo.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, ErrUnauthorized
+	}
+	userID, err := a.VerifyToken(token)
+	if err != nil {
+		return nil, err
+	}
+	return &User{ID: userID, Method: MethodWeChat}, nil
+}
+
+// Middleware 要求请求携带有效的凭证，并把调用方写入 echo.Context
+func (a *Authenticator) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user, err := a.Authenticate(c.Request())
+			if err != nil {
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+			}
+			c.Set(contextKey, user)
+			return next(c)
+		}
+	}
+}
+
+// RequireAdmin 要求调用方是管理员，需在 Middleware 之后使用
+func RequireAdmin() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if user := UserFrom(c); user == nil || !user.Admin {
+				return c.JSON(http.StatusForbidden, echo.Map{"error": "forbidden"})
+			}
+			return next(c)
+		}
+	}
+}
+
+// UserFrom 返回 Middleware 识别出的调用方，未经过认证时返回 nil
+func UserFrom(c echo.Context) *User {
+	user, _ := c.Get(contextKey).(*User)
+	return user
+}
+
+// UserID 返回调用方的 user_id，未经过认证时返回空字符串
+func UserID(c echo.Context) string {
+	if user := UserFrom(c); user != nil {
+		return user.ID
+	}
+	return ""
+}
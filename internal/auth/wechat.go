@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+)
+
+const (
+	code2SessionUrl      = "https://api.weixin.qq.com/sns/jscode2session"
+	defaultWeChatTimeout = 5 * time.Second
+)
+
+// WeChatSession 小程序登录凭证校验的结果
+type WeChatSession struct {
+	OpenID     string `json:"openid"`
+	UnionID    string `json:"unionid"`
+	SessionKey string `json:"session_key"`
+}
+
+// WeChatClient 微信接口，测试和本地开发时可以替换为 fake 实现
+type WeChatClient interface {
+	// Code2Session 用小程序 wx.login 得到的 code 换取 openid
+	Code2Session(ctx context.Context, code string) (*WeChatSession, error)
+}
+
+// NewWeChatClient 根据 [wechat] 配置创建微信接口客户端
+func NewWeChatClient(cfg config.WeChat) (WeChatClient, error) {
+	switch cfg.Provider {
+	case "", "wechat":
+		timeout := cfg.Timeout
+		if timeout <= 0 {
+			timeout = defaultWeChatTimeout
+		}
+		return &weChatClient{cfg: cfg, client: &http.Client{Timeout: timeout}}, nil
+	case "fake":
+		return FakeWeChatClient{}, nil
+	default:
+		return nil, fmt.Errorf("unknown wechat provider: %q", cfg.Provider)
+	}
+}
+
+type weChatClient struct {
+	cfg    config.WeChat
+	client *http.Client
+}
+
+type code2SessionResponse struct {
+	WeChatSession
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (w *weChatClient) Code2Session(ctx context.Context, code string) (*WeChatSession, error) {
+	query := url.Values{}
+	query.Set("appid", w.cfg.AppID)
+	query.Set("secret", w.cfg.AppSecret)
+	query.Set("js_code", code)
+	query.Set("grant_type", "authorization_code")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, code2SessionUrl+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("code2session response status code: %d", resp.StatusCode)
+	}
+
+	var response code2SessionResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	if response.ErrCode != 0 {
+		return nil, &WeChatError{Code: response.ErrCode, Message: response.ErrMsg}
+	}
+	if response.OpenID == "" {
+		return nil, fmt.Errorf("code2session returned empty openid")
+	}
+	return &response.WeChatSession, nil
+}
+
+// WeChatError 微信接口返回的业务错误，例如 code 无效或已被使用
+type WeChatError struct {
+	Code    int
+	Message string
+}
+
+func (e *WeChatError) Error() string {
+	return fmt.Sprintf("wechat errcode %d: %s", e.Code, e.Message)
+}
+
+// FakeWeChatClient 不访问微信，直接以 code 作为 openid，用于本地开发
+type FakeWeChatClient struct{}
+
+func (FakeWeChatClient) Code2Session(ctx context.Context, code string) (*WeChatSession, error) {
+	return &WeChatSession{OpenID: "fake-" + code, SessionKey: "fake"}, nil
+}
@@ -2,17 +2,32 @@ package config
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/fatih/structs"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	HTTP     HTTP     `mapstructure:"http" structs:"http"`
-	OpenAI   OpenAI   `mapstructure:"openai" structs:"openai"`
-	Otel     Otel     `mapstructure:"otel" structs:"otel"`
-	Cos      Cos      `mapstructure:"cos" structs:"cos"`
-	Database Database `mapstructure:"database" structs:"database"`
+	HTTP      HTTP      `mapstructure:"http" structs:"http"`
+	OpenAI    OpenAI    `mapstructure:"openai" structs:"openai"`
+	Detector  Detector  `mapstructure:"detector" structs:"detector"`
+	Pricing   Pricing   `mapstructure:"pricing" structs:"pricing"`
+	Detection Detection `mapstructure:"detection" structs:"detection"`
+	Otel      Otel      `mapstructure:"otel" structs:"otel"`
+	Cos       Cos       `mapstructure:"cos" structs:"cos"`
+	Storage   Storage   `mapstructure:"storage" structs:"storage"`
+	Upload    Upload    `mapstructure:"upload" structs:"upload"`
+	Auth      Auth      `mapstructure:"auth" structs:"auth"`
+	RateLimit RateLimit `mapstructure:"rate_limit" structs:"rate_limit"`
+	WeChat    WeChat    `mapstructure:"wechat" structs:"wechat"`
+	Database  Database  `mapstructure:"database" structs:"database"`
+	Queue     Queue     `mapstructure:"queue" structs:"queue"`
+	Retry     Retry     `mapstructure:"retry" structs:"retry"`
+	Webhook   Webhook   `mapstructure:"webhook" structs:"webhook"`
+	Cache     Cache     `mapstructure:"cache" structs:"cache"`
+	Image     Image     `mapstructure:"image" structs:"image"`
+	URLPolicy URLPolicy `mapstructure:"url_policy" structs:"url_policy"`
 }
 
 type HTTP struct {
@@ -25,6 +40,33 @@ type OpenAI struct {
 	Model   string `mapstructure:"model" structs:"model" env:"OPENAI_MODEL"`
 }
 
+type Detector struct {
+	Provider string        `mapstructure:"provider" structs:"provider" env:"DETECTOR_PROVIDER"` // openai, fake
+	Timeout  time.Duration `mapstructure:"timeout" structs:"timeout" env:"DETECTOR_TIMEOUT"`    // 单次调用超时
+}
+
+// Pricing 模型价格表，用于计算每个任务的费用
+type Pricing struct {
+	Currency string       `mapstructure:"currency" structs:"currency" env:"PRICING_CURRENCY"`
+	Models   []ModelPrice `mapstructure:"models" structs:"models"`
+}
+
+// ModelPrice 单个模型每百万 token 的价格
+type ModelPrice struct {
+	Model       string  `mapstructure:"model" structs:"model"`
+	InputPrice  float64 `mapstructure:"input_price" structs:"input_price"`
+	OutputPrice float64 `mapstructure:"output_price" structs:"output_price"`
+}
+
+type Detection struct {
+	SyncTimeout   time.Duration `mapstructure:"sync_timeout" structs:"sync_timeout" env:"DETECTION_SYNC_TIMEOUT"`          // 同步模式的最长等待时间
+	BatchMaxItems int           `mapstructure:"batch_max_items" structs:"batch_max_items" env:"DETECTION_BATCH_MAX_ITEMS"` // 单个批次最多包含的图片数
+	// 请求中直接携带的图片大小上限
+	InlineMaxBytes int `mapstructure:"inline_max_bytes" structs:"inline_max_bytes" env:"DETECTION_INLINE_MAX_BYTES"`
+	// 是否将请求中直接携带的图片记录为上传并生成缩略图，关闭时只在对象存储中保存原图供任务读取
+	PersistInlineImages bool `mapstructure:"persist_inline_images" structs:"persist_inline_images" env:"DETECTION_PERSIST_INLINE_IMAGES"`
+}
+
 type Otel struct {
 	ServiceName       string `mapstructure:"service_name" structs:"service_name" env:"OTEL_SERVICE_NAME"`
 	ServiceVersion    string `mapstructure:"service_version" structs:"service_version" env:"OTEL_SERVICE_VERSION"`
@@ -38,6 +80,86 @@ type Cos struct {
 	SecretKey string `mapstructure:"secret_key" structs:"secret_key" env:"COS_SECRET_KEY"`
 	Bucket    string `mapstructure:"bucket" structs:"bucket" env:"COS_BUCKET"`
 	Region    string `mapstructure:"region" structs:"region" env:"COS_REGION"`
+	// 获取临时密钥的接口，为空时只使用静态密钥
+	AuthUrl     string        `mapstructure:"auth_url" structs:"auth_url" env:"COS_AUTH_URL"`
+	RefreshSkew time.Duration `mapstructure:"refresh_skew" structs:"refresh_skew" env:"COS_REFRESH_SKEW"` // 临时密钥过期前多久开始刷新
+}
+
+type Storage struct {
+	Backend        string        `mapstructure:"backend" structs:"backend" env:"STORAGE_BACKEND"` // cos, s3, local
+	PresignExpires time.Duration `mapstructure:"presign_expires" structs:"presign_expires" env:"STORAGE_PRESIGN_EXPIRES"`
+	S3             S3            `mapstructure:"s3" structs:"s3"`
+	Local          Local         `mapstructure:"local" structs:"local"`
+}
+
+// S3 S3 兼容的对象存储，例如 MinIO
+type S3 struct {
+	Endpoint        string `mapstructure:"endpoint" structs:"endpoint" env:"S3_ENDPOINT"`
+	Region          string `mapstructure:"region" structs:"region" env:"S3_REGION"`
+	Bucket          string `mapstructure:"bucket" structs:"bucket" env:"S3_BUCKET"`
+	AccessKeyId     string `mapstructure:"access_key_id" structs:"access_key_id" env:"S3_ACCESS_KEY_ID"`
+	SecretAccessKey string `mapstructure:"secret_access_key" structs:"secret_access_key" env:"S3_SECRET_ACCESS_KEY"`
+	UseSSL          bool   `mapstructure:"use_ssl" structs:"use_ssl" env:"S3_USE_SSL"`
+	PathStyle       bool   `mapstructure:"path_style" structs:"path_style" env:"S3_PATH_STYLE"` // MinIO 一般需要开启
+}
+
+// Local 本地磁盘存储，文件由服务自身提供下载
+type Local struct {
+	Root       string `mapstructure:"root" structs:"root" env:"LOCAL_STORAGE_ROOT"`
+	BaseUrl    string `mapstructure:"base_url" structs:"base_url" env:"LOCAL_STORAGE_BASE_URL"` // 服务对外的访问地址，用于生成下载链接
+	SigningKey string `mapstructure:"signing_key" structs:"signing_key" env:"LOCAL_STORAGE_SIGNING_KEY"`
+}
+
+// Upload 上传图片的校验规则
+type Upload struct {
+	MaxBytes     int64 `mapstructure:"max_bytes" structs:"max_bytes" env:"UPLOAD_MAX_BYTES"`
+	MinDimension int   `mapstructure:"min_dimension" structs:"min_dimension" env:"UPLOAD_MIN_DIMENSION"`
+	MaxDimension int   `mapstructure:"max_dimension" structs:"max_dimension" env:"UPLOAD_MAX_DIMENSION"`
+	MaxPixels    int   `mapstructure:"max_pixels" structs:"max_pixels" env:"UPLOAD_MAX_PIXELS"`
+	// 直传凭证的有效期
+	TicketExpires time.Duration `mapstructure:"ticket_expires" structs:"ticket_expires" env:"UPLOAD_TICKET_EXPIRES"`
+	ThumbnailSize int           `mapstructure:"thumbnail_size" structs:"thumbnail_size" env:"UPLOAD_THUMBNAIL_SIZE"` // 缩略图长边
+	DisplaySize   int           `mapstructure:"display_size" structs:"display_size" env:"UPLOAD_DISPLAY_SIZE"`       // 展示图长边
+}
+
+type Auth struct {
+	TokenSecret string        `mapstructure:"token_secret" structs:"token_secret" env:"AUTH_TOKEN_SECRET"` // 签发登录 token 的密钥
+	TokenTTL    time.Duration `mapstructure:"token_ttl" structs:"token_ttl" env:"AUTH_TOKEN_TTL"`
+	APIKeys     []APIKey      `mapstructure:"api_keys" structs:"api_keys"`
+}
+
+// APIKey 服务端调用方使用的 API Key，配置中只保存 key 的 SHA-256
+type APIKey struct {
+	KeySha256 string `mapstructure:"key_sha256" structs:"key_sha256"`
+	UserID    string `mapstructure:"user_id" structs:"user_id"`
+	Admin     bool   `mapstructure:"admin" structs:"admin"` // 是否可以访问 /api/admin 下的接口
+	Tier      string `mapstructure:"tier" structs:"tier"`   // 限流档位，为空时使用 rate_limit.default_tier
+}
+
+// RateLimit 识别接口的限流和每日配额
+type RateLimit struct {
+	Enabled       bool   `mapstructure:"enabled" structs:"enabled" env:"RATE_LIMIT_ENABLED"`
+	DefaultTier   string `mapstructure:"default_tier" structs:"default_tier" env:"RATE_LIMIT_DEFAULT_TIER"`       // 登录用户和未指定档位的 API Key
+	AnonymousTier string `mapstructure:"anonymous_tier" structs:"anonymous_tier" env:"RATE_LIMIT_ANONYMOUS_TIER"` // 未认证的请求按 IP 限流
+	// 所有用户每天合计的识别次数，0 表示不限制
+	GlobalDailyQuota int             `mapstructure:"global_daily_quota" structs:"global_daily_quota" env:"RATE_LIMIT_GLOBAL_DAILY_QUOTA"`
+	Tiers            []RateLimitTier `mapstructure:"tiers" structs:"tiers"`
+}
+
+// RateLimitTier 限流档位，各项为 0 表示不限制
+type RateLimitTier struct {
+	Name       string  `mapstructure:"name" structs:"name"`
+	Rate       float64 `mapstructure:"rate" structs:"rate"`               // 每秒补充的请求数
+	Burst      int     `mapstructure:"burst" structs:"burst"`             // 允许的突发请求数
+	DailyQuota int     `mapstructure:"daily_quota" structs:"daily_quota"` // 每天的识别次数，批量识别按图片数计
+}
+
+// WeChat 小程序登录使用的配置
+type WeChat struct {
+	Provider  string        `mapstructure:"provider" structs:"provider" env:"WECHAT_PROVIDER"` // wechat, fake
+	AppID     string        `mapstructure:"app_id" structs:"app_id" env:"WECHAT_APP_ID"`
+	AppSecret string        `mapstructure:"app_secret" structs:"app_secret" env:"WECHAT_APP_SECRET"`
+	Timeout   time.Duration `mapstructure:"timeout" structs:"timeout" env:"WECHAT_TIMEOUT"`
 }
 
 type Database struct {
@@ -45,6 +167,57 @@ type Database struct {
 	DataSource string `mapstructure:"data_source" structs:"data_source" env:"DATABASE_DATA_SOURCE"`
 }
 
+type Queue struct {
+	Workers           int           `mapstructure:"workers" structs:"workers" env:"QUEUE_WORKERS"`
+	LeaseDuration     time.Duration `mapstructure:"lease_duration" structs:"lease_duration" env:"QUEUE_LEASE_DURATION"`
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval" structs:"heartbeat_interval" env:"QUEUE_HEARTBEAT_INTERVAL"`
+	PollInterval      time.Duration `mapstructure:"poll_interval" structs:"poll_interval" env:"QUEUE_POLL_INTERVAL"`
+}
+
+type Retry struct {
+	MaxAttempts    int           `mapstructure:"max_attempts" structs:"max_attempts" env:"RETRY_MAX_ATTEMPTS"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff" structs:"initial_backoff" env:"RETRY_INITIAL_BACKOFF"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff" structs:"max_backoff" env:"RETRY_MAX_BACKOFF"`
+	Multiplier     float64       `mapstructure:"multiplier" structs:"multiplier" env:"RETRY_MULTIPLIER"`
+	// 可重试的错误类型: rate_limit, server_error, timeout, invalid_output
+	RetryOn []string `mapstructure:"retry_on" structs:"retry_on" env:"RETRY_RETRY_ON"`
+}
+
+type Webhook struct {
+	Secret         string        `mapstructure:"secret" structs:"secret" env:"WEBHOOK_SECRET"` // 为空时不接受 callback_url
+	Timeout        time.Duration `mapstructure:"timeout" structs:"timeout" env:"WEBHOOK_TIMEOUT"`
+	MaxAttempts    int           `mapstructure:"max_attempts" structs:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	InitialBackoff time.Duration `mapstructure:"initial_backoff" structs:"initial_backoff" env:"WEBHOOK_INITIAL_BACKOFF"`
+	MaxBackoff     time.Duration `mapstructure:"max_backoff" structs:"max_backoff" env:"WEBHOOK_MAX_BACKOFF"`
+	Workers        int           `mapstructure:"workers" structs:"workers" env:"WEBHOOK_WORKERS"` // 同时投递回调的 worker 数
+	// 回调地址的域名白名单和是否允许内网地址，规则同 url_policy
+	Hosts        []string `mapstructure:"hosts" structs:"hosts" env:"WEBHOOK_HOSTS"`
+	AllowPrivate bool     `mapstructure:"allow_private" structs:"allow_private" env:"WEBHOOK_ALLOW_PRIVATE"`
+}
+
+type Cache struct {
+	Backend string        `mapstructure:"backend" structs:"backend" env:"CACHE_BACKEND"` // memory, db, none
+	Size    int           `mapstructure:"size" structs:"size" env:"CACHE_SIZE"`          // memory 模式下的最大条目数
+	TTL     time.Duration `mapstructure:"ttl" structs:"ttl" env:"CACHE_TTL"`
+	// db 模式下清理过期缓存的间隔
+	CleanupInterval time.Duration `mapstructure:"cleanup_interval" structs:"cleanup_interval" env:"CACHE_CLEANUP_INTERVAL"`
+}
+
+type Image struct {
+	MaxDimension int `mapstructure:"max_dimension" structs:"max_dimension" env:"IMAGE_MAX_DIMENSION"` // 发送给模型前长边缩小到该尺寸以内
+	JPEGQuality  int `mapstructure:"jpeg_quality" structs:"jpeg_quality" env:"IMAGE_JPEG_QUALITY"`
+}
+
+// URLPolicy 限制 image_url 可以访问的地址
+type URLPolicy struct {
+	Schemes          []string `mapstructure:"schemes" structs:"schemes" env:"URL_POLICY_SCHEMES"`
+	Hosts            []string `mapstructure:"hosts" structs:"hosts" env:"URL_POLICY_HOSTS"` // 域名白名单，支持 *.example.com，为空时不限制
+	AllowPrivate     bool     `mapstructure:"allow_private" structs:"allow_private" env:"URL_POLICY_ALLOW_PRIVATE"`
+	MaxRedirects     int      `mapstructure:"max_redirects" structs:"max_redirects" env:"URL_POLICY_MAX_REDIRECTS"` // 负数表示不允许重定向
+	MaxContentLength int64    `mapstructure:"max_content_length" structs:"max_content_length" env:"URL_POLICY_MAX_CONTENT_LENGTH"`
+	ContentTypes     []string `mapstructure:"content_types" structs:"content_types" env:"URL_POLICY_CONTENT_TYPES"`
+}
+
 func NewConfig(path string) (*Config, error) {
 	viper.SetConfigFile(path)
 	viper.SetConfigType("toml")
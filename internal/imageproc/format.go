@@ -0,0 +1,74 @@
+package imageproc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Format 通过文件头识别出的图片格式
+type Format string
+
+const (
+	JPEG Format = "jpeg"
+	PNG  Format = "png"
+	WebP Format = "webp"
+	HEIC Format = "heic"
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format, expect jpeg/png/webp")
+	ErrInvalidImage      = errors.New("invalid image")
+	// 模型接口不接受 HEIC，服务端也没有解码器，上传和识别时都直接拒绝
+	ErrHEICUnsupported = fmt.Errorf("%w: heic is not supported, convert to jpeg or png before uploading", ErrInvalidImage)
+)
+
+var heicBrands = map[string]bool{
+	"heic": true, "heix": true, "hevc": true, "hevx": true,
+	"heim": true, "heis": true, "mif1": true, "msf1": true,
+}
+
+// Sniff 根据文件头的魔数识别图片格式，不信任文件扩展名和 Content-Type。
+// HEIC 能被识别，但不支持处理，需要拒绝时返回 ErrHEICUnsupported 而不是 ErrUnsupportedFormat。
+func Sniff(data []byte) (Format, error) {
+	switch {
+	case len(data) >= 3 && bytes.Equal(data[:3], []byte{0xFF, 0xD8, 0xFF}):
+		return JPEG, nil
+	case len(data) >= 8 && bytes.Equal(data[:8], []byte("\x89PNG\r\n\x1a\n")):
+		return PNG, nil
+	case len(data) >= 12 && bytes.Equal(data[:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return WebP, nil
+	case len(data) >= 12 && bytes.Equal(data[4:8], []byte("ftyp")) && heicBrands[string(data[8:12])]:
+		return HEIC, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// ParseContentType 根据 MIME 类型返回图片格式
+func ParseContentType(contentType string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(contentType)) {
+	case "image/jpeg", "image/jpg":
+		return JPEG, nil
+	case "image/png":
+		return PNG, nil
+	case "image/webp":
+		return WebP, nil
+	case "image/heic", "image/heif":
+		return "", ErrHEICUnsupported
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// ContentType 返回格式对应的 MIME 类型
+func (f Format) ContentType() string {
+	return "image/" + string(f)
+}
+
+// Ext 返回格式对应的文件扩展名
+func (f Format) Ext() string {
+	if f == JPEG {
+		return ".jpg"
+	}
+	return "." + string(f)
+}
@@ -0,0 +1,25 @@
+package imageproc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHEICRejected(t *testing.T) {
+	// 只有 ftyp box 的 HEIC 文件头
+	heic := []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic")
+	if format, err := Sniff(heic); err != nil || format != HEIC {
+		t.Fatalf("Sniff() = %q, %v", format, err)
+	}
+	if _, err := Validate(heic, Limits{}); !errors.Is(err, ErrHEICUnsupported) {
+		t.Fatalf("Validate() error = %v, want ErrHEICUnsupported", err)
+	}
+	if _, err := Process(heic, Options{}); !errors.Is(err, ErrHEICUnsupported) {
+		t.Fatalf("Process() error = %v, want ErrHEICUnsupported", err)
+	}
+	for _, contentType := range []string{"image/heic", "image/heif"} {
+		if _, err := ParseContentType(contentType); !errors.Is(err, ErrHEICUnsupported) {
+			t.Fatalf("ParseContentType(%q) error = %v, want ErrHEICUnsupported", contentType, err)
+		}
+	}
+}
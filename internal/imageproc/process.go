@@ -0,0 +1,187 @@
+package imageproc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	defaultMaxDimension = 1536
+	defaultJPEGQuality  = 85
+)
+
+// Options 图片预处理参数
+type Options struct {
+	MaxDimension int // 长边超过该值时等比缩小
+	JPEGQuality  int
+	Limits       Limits // 解码前检查的原图尺寸限制
+}
+
+// Result 预处理后的图片
+type Result struct {
+	Data   []byte
+	Format Format
+	Width  int
+	Height int
+}
+
+// ContentType 返回处理后图片的 MIME 类型
+func (r *Result) ContentType() string {
+	return r.Format.ContentType()
+}
+
+// DataURL 返回 base64 编码的 data URL，可以直接作为图片地址传给模型
+func (r *Result) DataURL() string {
+	return "data:" + r.ContentType() + ";base64," + base64.StdEncoding.EncodeToString(r.Data)
+}
+
+// Process 校验图片格式，按 EXIF 方向摆正，缩小到最大尺寸以内并重新编码。
+// 重新编码后不再携带 EXIF（包括 GPS）等元数据。
+func Process(data []byte, opts Options) (*Result, error) {
+	src, err := Open(data, opts.Limits)
+	if err != nil {
+		return nil, err
+	}
+	return src.Render(opts)
+}
+
+// Source 解码后的图片，可以按不同尺寸多次导出
+type Source struct {
+	img         image.Image
+	format      Format
+	orientation int
+}
+
+// Open 识别格式，检查尺寸后解码图片
+func Open(data []byte, limits Limits) (*Source, error) {
+	format, err := Sniff(data)
+	if err != nil {
+		return nil, err
+	}
+	if format == HEIC {
+		return nil, ErrHEICUnsupported
+	}
+	// 先读头部信息检查尺寸，避免解码超大图片耗尽内存
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode %s: %v", ErrInvalidImage, format, err)
+	}
+	if err := limits.check(&Info{Format: format, Width: config.Width, Height: config.Height}); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode %s: %v", ErrInvalidImage, format, err)
+	}
+	return &Source{img: img, format: format, orientation: orientation(format, data)}, nil
+}
+
+// Render 缩小到最大尺寸以内，摆正方向后重新编码
+func (s *Source) Render(opts Options) (*Result, error) {
+	if opts.MaxDimension <= 0 {
+		opts.MaxDimension = defaultMaxDimension
+	}
+	if opts.JPEGQuality <= 0 || opts.JPEGQuality > 100 {
+		opts.JPEGQuality = defaultJPEGQuality
+	}
+
+	img := Resize(s.img, opts.MaxDimension)
+	img = orient(img, s.orientation)
+
+	var buf bytes.Buffer
+	var err error
+	out := JPEG
+	if s.format == PNG && !opaque(img) {
+		// 带透明通道的 PNG 保持 PNG，避免透明区域变黑
+		out = PNG
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: opts.JPEGQuality})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("encode %s: %w", out, err)
+	}
+
+	b := img.Bounds()
+	return &Result{Data: buf.Bytes(), Format: out, Width: b.Dx(), Height: b.Dy()}, nil
+}
+
+// Resize 等比缩小图片，使长边不超过 maxDimension，图片本身更小时原样返回
+func Resize(img image.Image, maxDimension int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if maxDimension <= 0 || (w <= maxDimension && h <= maxDimension) {
+		return img
+	}
+	if w >= h {
+		h = max(1, h*maxDimension/w)
+		w = maxDimension
+	} else {
+		w = max(1, w*maxDimension/h)
+		h = maxDimension
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// orient 按 EXIF Orientation（1-8）旋转或翻转图片
+func orient(img image.Image, o int) image.Image {
+	if o <= 1 || o > 8 {
+		return img
+	}
+	src := toNRGBA(img)
+	w, h := src.Rect.Dx(), src.Rect.Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2: // 水平翻转
+				dx, dy = w-1-x, y
+			case 3: // 旋转 180°
+				dx, dy = w-1-x, h-1-y
+			case 4: // 垂直翻转
+				dx, dy = x, h-1-y
+			case 5: // 沿主对角线翻转
+				dx, dy = y, x
+			case 6: // 顺时针旋转 90°
+				dx, dy = h-1-y, x
+			case 7: // 沿副对角线翻转
+				dx, dy = h-1-y, w-1-x
+			case 8: // 逆时针旋转 90°
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):dst.PixOffset(dx, dy)+4], src.Pix[src.PixOffset(x, y):src.PixOffset(x, y)+4])
+		}
+	}
+	return dst
+}
+
+func toNRGBA(img image.Image) *image.NRGBA {
+	if n, ok := img.(*image.NRGBA); ok && n.Rect.Min == (image.Point{}) {
+		return n
+	}
+	b := img.Bounds()
+	dst := image.NewNRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, b.Min, draw.Src)
+	return dst
+}
+
+func opaque(img image.Image) bool {
+	if o, ok := img.(interface{ Opaque() bool }); ok {
+		return o.Opaque()
+	}
+	return false
+}
@@ -0,0 +1,45 @@
+package imageproc
+
+import (
+	"fmt"
+)
+
+// Info 图片的基本信息
+type Info struct {
+	Format Format
+	Width  int
+	Height int
+}
+
+// Limits 图片尺寸限制，零值表示不限制
+type Limits struct {
+	MinDimension int // 宽和高的最小值
+	MaxDimension int // 宽和高的最大值
+	MaxPixels    int // 宽 x 高的最大值，防止解压炸弹
+}
+
+// Validate 按文件头识别格式，检查尺寸后完整解码一次，确认内容确实是一张图片。
+// HEIC 没有解码器，返回 ErrHEICUnsupported。
+func Validate(data []byte, limits Limits) (*Info, error) {
+	src, err := Open(data, limits)
+	if err != nil {
+		return nil, err
+	}
+	b := src.img.Bounds()
+	return &Info{Format: src.format, Width: b.Dx(), Height: b.Dy()}, nil
+}
+
+func (l Limits) check(info *Info) error {
+	w, h := info.Width, info.Height
+	switch {
+	case w <= 0 || h <= 0:
+		return fmt.Errorf("%w: empty image", ErrInvalidImage)
+	case l.MinDimension > 0 && (w < l.MinDimension || h < l.MinDimension):
+		return fmt.Errorf("%w: image %dx%d is smaller than %dpx", ErrInvalidImage, w, h, l.MinDimension)
+	case l.MaxDimension > 0 && (w > l.MaxDimension || h > l.MaxDimension):
+		return fmt.Errorf("%w: image %dx%d is larger than %dpx", ErrInvalidImage, w, h, l.MaxDimension)
+	case l.MaxPixels > 0 && w*h > l.MaxPixels:
+		return fmt.Errorf("%w: image %dx%d has more than %d pixels", ErrInvalidImage, w, h, l.MaxPixels)
+	}
+	return nil
+}
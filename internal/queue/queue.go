@@ -0,0 +1,257 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultWorkers           = 10
+	defaultLeaseDuration     = 60 * time.Second
+	defaultHeartbeatInterval = 20 * time.Second
+	defaultPollInterval      = time.Second
+)
+
+// Handler 处理一个已被当前 worker 领取的任务。
+// 租约丢失或进程退出时 ctx 会被取消，此时 Handler 不应再写入任务状态。
+type Handler func(ctx context.Context, task repository.Task) error
+
+// Queue 基于 tasks 表的持久化任务队列。
+// worker 通过 SELECT ... FOR UPDATE SKIP LOCKED 领取任务并持有租约，
+// 处理期间定期续约；进程崩溃后租约过期，任务会被重新排队。
+type Queue struct {
+	db      *sql.DB
+	queries *repository.Queries
+	cfg     config.Queue
+	owner   string
+	notify  chan struct{}
+	logger  echo.Logger
+
+	mu      sync.Mutex
+	running map[string]context.CancelFunc // 当前进程正在执行的任务
+}
+
+func New(db *sql.DB, cfg config.Queue, logger echo.Logger) *Queue {
+	if cfg.Workers <= 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.LeaseDuration <= 0 {
+		cfg.LeaseDuration = defaultLeaseDuration
+	}
+	if cfg.HeartbeatInterval <= 0 || cfg.HeartbeatInterval >= cfg.LeaseDuration {
+		cfg.HeartbeatInterval = cfg.LeaseDuration / 3
+	}
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+
+	hostname, _ := os.Hostname()
+	return &Queue{
+		db:      db,
+		queries: repository.New(db),
+		cfg:     cfg,
+		owner:   fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), uuid.New().String()[:8]),
+		notify:  make(chan struct{}, 1),
+		logger:  logger,
+		running: make(map[string]context.CancelFunc),
+	}
+}
+
+// Owner 返回当前进程写入 lease_owner 的标识
+func (q *Queue) Owner() string {
+	return q.owner
+}
+
+// Notify 唤醒一个空闲的 worker，在新任务入库后调用以减少等待
+func (q *Queue) Notify() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Cancel 取消当前进程中正在执行的任务，任务不在本进程执行时返回 false。
+// 其它实例上执行的任务在续约失败后取消。
+func (q *Queue) Cancel(taskId string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	cancel, ok := q.running[taskId]
+	if ok {
+		cancel()
+	}
+	return ok
+}
+
+// Run 启动回收协程和 worker，阻塞直到 ctx 结束且所有 worker 退出
+func (q *Queue) Run(ctx context.Context, handler Handler) {
+	// 启动时先回收上次崩溃遗留的过期租约
+	q.reap(ctx)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(q.cfg.LeaseDuration)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				q.reap(ctx)
+			}
+		}
+	}()
+
+	for i := 0; i < q.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.work(ctx, handler)
+		}()
+	}
+	wg.Wait()
+}
+
+func (q *Queue) reap(ctx context.Context) {
+	result, err := q.queries.RequeueExpiredTasks(ctx)
+	if err != nil {
+		q.logger.Errorf("requeue expired tasks failed: %v", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		q.logger.Warnf("requeued %d tasks with expired lease", n)
+	}
+}
+
+func (q *Queue) work(ctx context.Context, handler Handler) {
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+
+		task, err := q.claim(ctx)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			q.logger.Errorf("claim task failed: %v", err)
+		}
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.notify:
+			case <-time.After(q.cfg.PollInterval):
+			}
+			continue
+		}
+
+		q.process(ctx, task, handler)
+	}
+}
+
+// claim 在事务中领取最早的待处理任务，没有任务时返回 sql.ErrNoRows
+func (q *Queue) claim(ctx context.Context) (repository.Task, error) {
+	tx, err := q.db.BeginTx(ctx, nil)
+	if err != nil {
+		return repository.Task{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := q.queries.WithTx(tx)
+	task, err := qtx.GetNextPendingTask(ctx)
+	if err != nil {
+		return repository.Task{}, err
+	}
+	if err := qtx.LeaseTask(ctx, repository.LeaseTaskParams{
+		LeaseOwner:   sql.NullString{String: q.owner, Valid: true},
+		LeaseSeconds: int64(q.cfg.LeaseDuration.Seconds()),
+		ID:           task.ID,
+	}); err != nil {
+		return repository.Task{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return repository.Task{}, err
+	}
+
+	task.Status = "running"
+	task.Attempts++
+	task.LeaseOwner = sql.NullString{String: q.owner, Valid: true}
+	return task, nil
+}
+
+func (q *Queue) process(ctx context.Context, task repository.Task, handler Handler) {
+	// 任务的 context 独立于 ctx，这样进程退出时可以先取消任务再归还租约
+	taskCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q.mu.Lock()
+	q.running[task.TaskID] = cancel
+	q.mu.Unlock()
+	defer func() {
+		q.mu.Lock()
+		delete(q.running, task.TaskID)
+		q.mu.Unlock()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		q.heartbeat(ctx, taskCtx, task.TaskID, cancel)
+	}()
+
+	if err := handler(taskCtx, task); err != nil {
+		q.logger.Errorf("exec task %s failed: %v", task.TaskID, err)
+	}
+	cancel()
+	<-done
+
+	if ctx.Err() != nil {
+		// 进程退出导致任务中断，归还租约让其它实例尽快接手
+		releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer releaseCancel()
+		if _, err := q.queries.ReleaseTask(releaseCtx, repository.ReleaseTaskParams{
+			TaskID:     task.TaskID,
+			LeaseOwner: sql.NullString{String: q.owner, Valid: true},
+		}); err != nil {
+			q.logger.Errorf("release task %s failed: %v", task.TaskID, err)
+		}
+	}
+}
+
+// heartbeat 定期续约，租约丢失或进程退出时取消任务
+func (q *Queue) heartbeat(ctx, taskCtx context.Context, taskId string, cancel context.CancelFunc) {
+	ticker := time.NewTicker(q.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-taskCtx.Done():
+			return
+		case <-ctx.Done():
+			cancel()
+			return
+		case <-ticker.C:
+			result, err := q.queries.HeartbeatTask(taskCtx, repository.HeartbeatTaskParams{
+				LeaseSeconds: int64(q.cfg.LeaseDuration.Seconds()),
+				TaskID:       taskId,
+				LeaseOwner:   sql.NullString{String: q.owner, Valid: true},
+			})
+			if err != nil {
+				q.logger.Errorf("heartbeat task %s failed: %v", taskId, err)
+				continue
+			}
+			if n, _ := result.RowsAffected(); n == 0 {
+				q.logger.Warnf("lease of task %s lost", taskId)
+				cancel()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/labstack/echo/v4"
+)
+
+var taskColumns = []string{
+	"id", "task_id", "user_id", "status", "image_url", "image_key", "detection_type", "response_mode", "force_refresh",
+	"image_hash", "callback_url", "batch_id", "result", "result_name", "overall_score", "model",
+	"prompt_tokens", "completion_tokens", "latency_ms", "cost", "attempts", "last_error",
+	"available_at", "lease_owner", "lease_expires_at", "created_at", "updated_at",
+}
+
+func newTestQueue(t *testing.T, cfg config.Queue) (*Queue, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return New(db, cfg, echo.New().Logger), mock
+}
+
+func leasedTask(q *Queue) repository.Task {
+	return repository.Task{
+		ID:         1,
+		TaskID:     "task-1",
+		Status:     "running",
+		Attempts:   1,
+		LeaseOwner: sql.NullString{String: q.Owner(), Valid: true},
+	}
+}
+
+func TestReapRequeuesExpiredLeases(t *testing.T) {
+	q, mock := newTestQueue(t, config.Queue{})
+	mock.ExpectExec(regexp.QuoteMeta("SET status = 'pending', lease_owner = NULL, lease_expires_at = NULL\nWHERE status = 'running' AND lease_expires_at < NOW()")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	q.reap(context.Background())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClaimLeasesRequeuedTask(t *testing.T) {
+	q, mock := newTestQueue(t, config.Queue{LeaseDuration: time.Minute})
+	// 被回收的任务重新回到 pending，attempts 保留上次领取的次数
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE status = 'pending' AND available_at <= NOW()")).
+		WillReturnRows(sqlmock.NewRows(taskColumns).AddRow(
+			1, "task-1", nil, "pending", "https://example.com/a.jpg", nil, "fruit", "", false,
+			nil, nil, nil, nil, nil, nil, nil,
+			0, 0, 0, 0.0, 1, nil,
+			time.Now(), nil, nil, nil, nil,
+		))
+	mock.ExpectExec(regexp.QuoteMeta("SET status = 'running', attempts = attempts + 1")).
+		WithArgs(q.Owner(), int64(60), int32(1)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	task, err := q.claim(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Status != "running" || task.Attempts != 2 || task.LeaseOwner.String != q.Owner() {
+		t.Fatalf("unexpected claimed task: status=%s attempts=%d owner=%s", task.Status, task.Attempts, task.LeaseOwner.String)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHeartbeatCancelsTaskWhenLeaseLost(t *testing.T) {
+	q, mock := newTestQueue(t, config.Queue{LeaseDuration: time.Minute, HeartbeatInterval: 10 * time.Millisecond})
+	task := leasedTask(q)
+	// 租约已被回收或任务已被取消，续约命中 0 行
+	mock.ExpectExec(regexp.QuoteMeta("SET lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND)")).
+		WithArgs(int64(60), task.TaskID, q.Owner()).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	cancelled := make(chan struct{})
+	handler := func(ctx context.Context, task repository.Task) error {
+		select {
+		case <-ctx.Done():
+			close(cancelled)
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	}
+	q.process(context.Background(), task, handler)
+
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("handler context was not cancelled after lease lost")
+	}
+	if q.Cancel(task.TaskID) {
+		t.Fatal("task still registered as running")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessReleasesTaskOnShutdown(t *testing.T) {
+	q, mock := newTestQueue(t, config.Queue{LeaseDuration: time.Hour, HeartbeatInterval: 30 * time.Minute})
+	task := leasedTask(q)
+	// 归还租约时撤销领取时增加的 attempts，多次发布不会让任务达到执行次数上限
+	mock.ExpectExec(regexp.QuoteMeta("SET status = 'pending', attempts = attempts - 1, lease_owner = NULL, lease_expires_at = NULL\nWHERE task_id = ? AND status = 'running' AND lease_owner = ?")).
+		WithArgs(task.TaskID, q.Owner()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	go func() {
+		<-started
+		cancel()
+	}()
+	handler := func(taskCtx context.Context, task repository.Task) error {
+		close(started)
+		<-taskCtx.Done()
+		return taskCtx.Err()
+	}
+	q.process(ctx, task, handler)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProcessKeepsAttemptsWhenTaskFinishes(t *testing.T) {
+	q, mock := newTestQueue(t, config.Queue{LeaseDuration: time.Hour, HeartbeatInterval: 30 * time.Minute})
+	task := leasedTask(q)
+
+	// 任务正常结束（包括失败）时不归还租约，本次执行计入 attempts
+	q.process(context.Background(), task, func(ctx context.Context, task repository.Task) error {
+		return errors.New("provider error")
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// 空闲的桶会在填满后被清理，清理最多每隔该时间执行一次
+const sweepInterval = time.Minute
+
+// Rate 令牌桶参数，PerSecond 为每秒补充的令牌数，Burst 为桶容量
+type Rate struct {
+	PerSecond float64
+	Burst     int
+}
+
+// Unlimited 是否不限制
+func (r Rate) Unlimited() bool {
+	return r.PerSecond <= 0 || r.Burst <= 0
+}
+
+// Result 一次限流判断的结果
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Time     // 桶重新填满的时间
+	RetryAfter time.Duration // 被限流时距离下一个令牌的时间
+}
+
+type bucket struct {
+	rate   Rate
+	tokens float64
+	last   time.Time
+}
+
+// Limiter 进程内按 key 区分的令牌桶
+type Limiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+// Allow 从 key 对应的桶中取一个令牌
+func (l *Limiter) Allow(key string, rate Rate) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{rate: rate, tokens: float64(rate.Burst), last: now}
+		l.buckets[key] = b
+	}
+	// 用户的档位可能变化，按最新的参数补充令牌
+	b.rate = rate
+	b.fill(now)
+
+	result := Result{Limit: rate.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = seconds((1 - b.tokens) / rate.PerSecond)
+	}
+	result.Remaining = int(math.Floor(b.tokens))
+	result.Reset = now.Add(seconds((float64(rate.Burst) - b.tokens) / rate.PerSecond))
+	return result
+}
+
+func (b *bucket) fill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(b.rate.Burst), b.tokens+elapsed*b.rate.PerSecond)
+	}
+	b.last = now
+}
+
+// sweep 清理已经填满的桶，它们与新建的桶没有区别
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		b.fill(now)
+		if b.tokens >= float64(b.rate.Burst) {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
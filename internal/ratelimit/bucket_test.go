@@ -0,0 +1,100 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestLimiter() (*Limiter, *time.Time) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	l, now := newTestLimiter()
+	rate := Rate{PerSecond: 2, Burst: 3}
+
+	// 新建的桶是满的，可以连续通过 burst 次
+	for i := 0; i < rate.Burst; i++ {
+		result := l.Allow("user:1", rate)
+		if !result.Allowed {
+			t.Fatalf("request %d should be allowed", i)
+		}
+		if want := rate.Burst - i - 1; result.Remaining != want {
+			t.Fatalf("request %d remaining = %d, want %d", i, result.Remaining, want)
+		}
+	}
+	result := l.Allow("user:1", rate)
+	if result.Allowed {
+		t.Fatal("request over burst should be limited")
+	}
+	if result.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("retry after = %v, want 500ms", result.RetryAfter)
+	}
+	if want := now.Add(1500 * time.Millisecond); !result.Reset.Equal(want) {
+		t.Fatalf("reset = %v, want %v", result.Reset, want)
+	}
+
+	// 按速率补充令牌
+	*now = now.Add(500 * time.Millisecond)
+	if !l.Allow("user:1", rate).Allowed {
+		t.Fatal("request after refill should be allowed")
+	}
+	if l.Allow("user:1", rate).Allowed {
+		t.Fatal("only one token should be refilled")
+	}
+
+	// 补充的令牌不超过桶容量
+	*now = now.Add(time.Hour)
+	if result := l.Allow("user:1", rate); !result.Allowed || result.Remaining != rate.Burst-1 {
+		t.Fatalf("unexpected result after idle: %+v", result)
+	}
+}
+
+func TestLimiterKeysAreIndependent(t *testing.T) {
+	l, _ := newTestLimiter()
+	rate := Rate{PerSecond: 1, Burst: 1}
+	if !l.Allow("user:1", rate).Allowed {
+		t.Fatal("first request should be allowed")
+	}
+	if l.Allow("user:1", rate).Allowed {
+		t.Fatal("second request should be limited")
+	}
+	if !l.Allow("ip:127.0.0.1", rate).Allowed {
+		t.Fatal("other keys should not be limited")
+	}
+}
+
+func TestLimiterSweep(t *testing.T) {
+	l, now := newTestLimiter()
+	l.Allow("user:1", Rate{PerSecond: 1, Burst: 2})
+	l.Allow("user:2", Rate{PerSecond: 0.001, Burst: 2})
+
+	// 已经填满的桶会被清理，未填满的保留
+	*now = now.Add(sweepInterval)
+	l.Allow("user:3", Rate{PerSecond: 1, Burst: 2})
+	if _, ok := l.buckets["user:1"]; ok {
+		t.Fatal("full bucket should be swept")
+	}
+	if _, ok := l.buckets["user:2"]; !ok {
+		t.Fatal("bucket not yet refilled should be kept")
+	}
+}
+
+func TestRateUnlimited(t *testing.T) {
+	tests := []struct {
+		rate Rate
+		want bool
+	}{
+		{Rate{PerSecond: 1, Burst: 1}, false},
+		{Rate{PerSecond: 0, Burst: 5}, true},
+		{Rate{PerSecond: 1, Burst: 0}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.rate.Unlimited(); got != tt.want {
+			t.Errorf("%+v Unlimited() = %v, want %v", tt.rate, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package ratelimit
+
+import (
+	"context"
+
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+)
+
+// GlobalSubject 全局每日配额的计数对象
+const GlobalSubject = "global"
+
+// QuotaLimit 一个计数对象的每日配额，Limit 为 0 表示不限制
+type QuotaLimit struct {
+	Subject string
+	Limit   int
+}
+
+// consumeQuota 扣减保存在 daily_quotas 表中的每日配额，多个实例共享计数。
+// qtx 需要绑定调用方的事务：任一配额不足或事务回滚时都不会扣减，
+// 返回第一个不足的配额。
+func consumeQuota(ctx context.Context, qtx *repository.Queries, amount int, limits ...QuotaLimit) (*QuotaLimit, error) {
+	for i, limit := range limits {
+		if limit.Limit <= 0 {
+			continue
+		}
+		if err := qtx.EnsureDailyQuota(ctx, limit.Subject); err != nil {
+			return nil, err
+		}
+		result, err := qtx.ConsumeDailyQuota(ctx, repository.ConsumeDailyQuotaParams{
+			Amount:  int32(amount),
+			Subject: limit.Subject,
+			Quota:   int32(limit.Limit),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 0 {
+			return &limits[i], nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/auth"
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	HeaderLimit     = "X-RateLimit-Limit"
+	HeaderRemaining = "X-RateLimit-Remaining"
+	HeaderReset     = "X-RateLimit-Reset" // 重置时间的 Unix 秒
+	HeaderScope     = "X-RateLimit-Scope" // rate 或 quota
+)
+
+// ExceededError 超出每日配额
+type ExceededError struct {
+	Subject string
+	Limit   int
+	Reset   time.Time
+}
+
+func (e *ExceededError) Error() string {
+	if e.Subject == GlobalSubject {
+		return "service daily quota exceeded"
+	}
+	return fmt.Sprintf("daily quota of %d exceeded", e.Limit)
+}
+
+// Respond 返回 429 和配额相关的响应头
+func (e *ExceededError) Respond(c echo.Context) error {
+	h := c.Response().Header()
+	h.Set(HeaderScope, "quota")
+	h.Set(HeaderLimit, strconv.Itoa(e.Limit))
+	h.Set(HeaderRemaining, "0")
+	h.Set(HeaderReset, strconv.FormatInt(e.Reset.Unix(), 10))
+	h.Set(echo.HeaderRetryAfter, retryAfter(time.Until(e.Reset)))
+	return c.JSON(http.StatusTooManyRequests, echo.Map{"error": e.Error()})
+}
+
+// RateLimiter 按 API Key、用户或 IP 限流，并扣减每日配额
+type RateLimiter struct {
+	cfg     config.RateLimit
+	tiers   map[string]config.RateLimitTier
+	limiter *Limiter
+}
+
+func New(cfg config.RateLimit) (*RateLimiter, error) {
+	r := &RateLimiter{
+		cfg:     cfg,
+		tiers:   make(map[string]config.RateLimitTier, len(cfg.Tiers)),
+		limiter: NewLimiter(),
+	}
+	for _, t := range cfg.Tiers {
+		r.tiers[t.Name] = t
+	}
+	for _, name := range []string{cfg.DefaultTier, cfg.AnonymousTier} {
+		if _, ok := r.tiers[name]; name != "" && !ok {
+			return nil, fmt.Errorf("unknown rate limit tier: %q", name)
+		}
+	}
+	return r, nil
+}
+
+// subject 返回计数对象和适用的档位。
+// API Key 和登录用户按 user_id 计数，未认证的请求按 IP 计数。
+func (r *RateLimiter) subject(c echo.Context) (string, config.RateLimitTier) {
+	user := auth.UserFrom(c)
+	if user == nil {
+		return "ip:" + c.RealIP(), r.tiers[r.cfg.AnonymousTier]
+	}
+	tier, ok := r.tiers[user.Tier]
+	if !ok {
+		tier = r.tiers[r.cfg.DefaultTier]
+	}
+	return "user:" + user.ID, tier
+}
+
+// Middleware 令牌桶限流，超出时返回 429。
+// 计数保存在进程内，多实例部署时每个实例单独计数。
+func (r *RateLimiter) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !r.cfg.Enabled {
+				return next(c)
+			}
+			subject, tier := r.subject(c)
+			rate := Rate{PerSecond: tier.Rate, Burst: tier.Burst}
+			if rate.Unlimited() {
+				return next(c)
+			}
+
+			result := r.limiter.Allow(subject, rate)
+			h := c.Response().Header()
+			h.Set(HeaderLimit, strconv.Itoa(result.Limit))
+			h.Set(HeaderRemaining, strconv.Itoa(result.Remaining))
+			h.Set(HeaderReset, strconv.FormatInt(result.Reset.Unix(), 10))
+			if !result.Allowed {
+				h.Set(HeaderScope, "rate")
+				h.Set(echo.HeaderRetryAfter, retryAfter(result.RetryAfter))
+				return c.JSON(http.StatusTooManyRequests, echo.Map{"error": "rate limit exceeded"})
+			}
+			return next(c)
+		}
+	}
+}
+
+// ConsumeQuota 扣减调用方和全局的每日配额，不足时返回 *ExceededError。
+// qtx 应与创建任务使用同一个事务，任务创建失败回滚时配额不会被扣减。
+func (r *RateLimiter) ConsumeQuota(c echo.Context, qtx *repository.Queries, amount int) error {
+	if !r.cfg.Enabled {
+		return nil
+	}
+	subject, tier := r.subject(c)
+	exceeded, err := consumeQuota(c.Request().Context(), qtx, amount,
+		QuotaLimit{Subject: subject, Limit: tier.DailyQuota},
+		QuotaLimit{Subject: GlobalSubject, Limit: r.cfg.GlobalDailyQuota},
+	)
+	if err != nil {
+		return err
+	}
+	if exceeded != nil {
+		// 配额按数据库的日期计数，这里按本地时区的零点估算重置时间
+		now := time.Now()
+		reset := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
+		return &ExceededError{Subject: exceeded.Subject, Limit: exceeded.Limit, Reset: reset}
+	}
+	return nil
+}
+
+// retryAfter 向上取整到秒，至少为 1
+func retryAfter(d time.Duration) string {
+	return strconv.FormatInt(max(1, int64(math.Ceil(d.Seconds()))), 10)
+}
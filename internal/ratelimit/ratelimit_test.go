@@ -0,0 +1,302 @@
+package ratelimit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fanchunke/deeppick-ai/internal/auth"
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/labstack/echo/v4"
+)
+
+var testConfig = config.RateLimit{
+	Enabled:       true,
+	DefaultTier:   "free",
+	AnonymousTier: "anonymous",
+	Tiers: []config.RateLimitTier{
+		{Name: "anonymous", Rate: 1, Burst: 1},
+		{Name: "free", Rate: 1, Burst: 2, DailyQuota: 5},
+		{Name: "pro", Rate: 1, Burst: 10},
+	},
+}
+
+func keySha256(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// serve 经过认证中间件调用 handler，apiKey 为空时按未认证请求处理
+func serve(t *testing.T, apiKey string, handler echo.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	authenticator, err := auth.NewAuthenticator(config.Auth{APIKeys: []config.APIKey{
+		{KeySha256: keySha256("free-key"), UserID: "u1"},
+		{KeySha256: keySha256("pro-key"), UserID: "u2", Tier: "pro"},
+		{KeySha256: keySha256("unknown-tier-key"), UserID: "u3", Tier: "missing"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/image/detect", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	if apiKey != "" {
+		req.Header.Set(auth.HeaderAPIKey, apiKey)
+		handler = authenticator.Middleware()(handler)
+	}
+	if err := handler(c); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestNewRejectsUnknownTier(t *testing.T) {
+	cfg := testConfig
+	cfg.DefaultTier = "missing"
+	if _, err := New(cfg); err == nil {
+		t.Fatal("expected unknown tier error")
+	}
+}
+
+func TestTierResolution(t *testing.T) {
+	r, err := New(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		apiKey  string
+		subject string
+		tier    string
+	}{
+		{name: "anonymous by ip", subject: "ip:192.0.2.1", tier: "anonymous"},
+		{name: "default tier", apiKey: "free-key", subject: "user:u1", tier: "free"},
+		{name: "api key tier", apiKey: "pro-key", subject: "user:u2", tier: "pro"},
+		{name: "unknown tier falls back to default", apiKey: "unknown-tier-key", subject: "user:u3", tier: "free"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serve(t, tt.apiKey, func(c echo.Context) error {
+				subject, tier := r.subject(c)
+				if subject != tt.subject || tier.Name != tt.tier {
+					t.Fatalf("subject = %q tier = %q, want %q %q", subject, tier.Name, tt.subject, tt.tier)
+				}
+				return nil
+			})
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	r, err := New(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok := func(c echo.Context) error { return c.NoContent(http.StatusOK) }
+	handler := r.Middleware()(ok)
+
+	// free 档位 burst 为 2
+	for i := 0; i < 2; i++ {
+		rec := serve(t, "free-key", handler)
+		if rec.Code != http.StatusOK || rec.Header().Get(HeaderLimit) != "2" {
+			t.Fatalf("request %d: code = %d limit = %q", i, rec.Code, rec.Header().Get(HeaderLimit))
+		}
+	}
+	rec := serve(t, "free-key", handler)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("code = %d, want 429", rec.Code)
+	}
+	if rec.Header().Get(HeaderScope) != "rate" || rec.Header().Get(echo.HeaderRetryAfter) != "1" {
+		t.Fatalf("unexpected headers: %v", rec.Header())
+	}
+
+	// 其它用户单独计数
+	if rec := serve(t, "pro-key", handler); rec.Code != http.StatusOK {
+		t.Fatalf("other user code = %d, want 200", rec.Code)
+	}
+}
+
+func TestMiddlewareUnlimitedTier(t *testing.T) {
+	cfg := testConfig
+	cfg.Tiers = []config.RateLimitTier{{Name: "anonymous"}, {Name: "free"}}
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := r.Middleware()(func(c echo.Context) error { return c.NoContent(http.StatusOK) })
+	for i := 0; i < 10; i++ {
+		rec := serve(t, "", handler)
+		if rec.Code != http.StatusOK || rec.Header().Get(HeaderLimit) != "" {
+			t.Fatalf("request %d: code = %d limit = %q", i, rec.Code, rec.Header().Get(HeaderLimit))
+		}
+	}
+}
+
+func newQuotaTx(t *testing.T) (*repository.Queries, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	mock.ExpectBegin()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { tx.Rollback() })
+	return repository.New(db).WithTx(tx), mock
+}
+
+func expectConsume(mock sqlmock.Sqlmock, subject string, amount, quota int, affected int64) {
+	mock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO daily_quotas")).WithArgs(subject).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE daily_quotas")).WithArgs(amount, subject, amount, quota).
+		WillReturnResult(sqlmock.NewResult(0, affected))
+}
+
+func TestConsumeQuota(t *testing.T) {
+	tests := []struct {
+		name    string
+		apiKey  string
+		global  int
+		expect  func(mock sqlmock.Sqlmock)
+		subject string // 为空表示未超出
+	}{
+		{
+			name:   "within quota",
+			apiKey: "free-key",
+			expect: func(mock sqlmock.Sqlmock) { expectConsume(mock, "user:u1", 1, 5, 1) },
+		},
+		{
+			name:    "user quota exceeded",
+			apiKey:  "free-key",
+			expect:  func(mock sqlmock.Sqlmock) { expectConsume(mock, "user:u1", 1, 5, 0) },
+			subject: "user:u1",
+		},
+		{
+			// daily_quota = 0 表示不限制，不读写 daily_quotas
+			name:   "unlimited daily quota",
+			apiKey: "pro-key",
+			expect: func(mock sqlmock.Sqlmock) {},
+		},
+		{
+			name:   "global quota exceeded",
+			apiKey: "pro-key",
+			global: 100,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectConsume(mock, GlobalSubject, 1, 100, 0)
+			},
+			subject: GlobalSubject,
+		},
+		{
+			// 用户配额扣减后全局配额不足，事务回滚时一并撤销
+			name:   "user and global quota",
+			apiKey: "free-key",
+			global: 100,
+			expect: func(mock sqlmock.Sqlmock) {
+				expectConsume(mock, "user:u1", 1, 5, 1)
+				expectConsume(mock, GlobalSubject, 1, 100, 0)
+			},
+			subject: GlobalSubject,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig
+			cfg.GlobalDailyQuota = tt.global
+			r, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			qtx, mock := newQuotaTx(t)
+			tt.expect(mock)
+
+			serve(t, tt.apiKey, func(c echo.Context) error {
+				err := r.ConsumeQuota(c, qtx, 1)
+				var exceeded *ExceededError
+				if tt.subject == "" {
+					if err != nil {
+						t.Fatalf("unexpected error: %v", err)
+					}
+				} else if !errors.As(err, &exceeded) || exceeded.Subject != tt.subject {
+					t.Fatalf("expected quota of %q exceeded, got %v", tt.subject, err)
+				}
+				return nil
+			})
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestConsumeQuotaRolledBackWithTask(t *testing.T) {
+	r, err := New(testConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// 配额和任务在同一个事务中，创建任务失败时回滚，不提交配额的扣减
+	mock.ExpectBegin()
+	expectConsume(mock, "user:u1", 1, 5, 1)
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO tasks")).WillReturnError(errors.New("insert failed"))
+	mock.ExpectRollback()
+
+	createTask := func(c echo.Context) error {
+		ctx := c.Request().Context()
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		qtx := repository.New(db).WithTx(tx)
+		if err := r.ConsumeQuota(c, qtx, 1); err != nil {
+			return err
+		}
+		if _, err := qtx.CreateTask(ctx, repository.CreateTaskParams{TaskID: "task-1"}); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+	serve(t, "free-key", func(c echo.Context) error {
+		if err := createTask(c); err == nil {
+			t.Fatal("expected create task error")
+		}
+		return nil
+	})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConsumeQuotaDisabled(t *testing.T) {
+	cfg := testConfig
+	cfg.Enabled = false
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	qtx, mock := newQuotaTx(t)
+	serve(t, "free-key", func(c echo.Context) error {
+		if err := r.ConsumeQuota(c, qtx, 1); err != nil {
+			t.Fatal(err)
+		}
+		return nil
+	})
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,49 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: batch.sql
+
+package repository
+
+import (
+	"context"
+	sql "database/sql"
+)
+
+const createBatch = `-- name: CreateBatch :execresult
+INSERT INTO batches (
+    batch_id, user_id, total
+) VALUES (
+ ?, ?, ?
+)
+`
+
+type CreateBatchParams struct {
+	BatchID string
+	UserID  sql.NullString
+	Total   int32
+}
+
+func (q *Queries) CreateBatch(ctx context.Context, arg CreateBatchParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, createBatch, arg.BatchID, arg.UserID, arg.Total)
+}
+
+const getBatch = `-- name: GetBatch :one
+SELECT id, batch_id, user_id, total, created_at, updated_at
+FROM batches
+WHERE batch_id = ?
+`
+
+func (q *Queries) GetBatch(ctx context.Context, batchID string) (Batch, error) {
+	row := q.db.QueryRowContext(ctx, getBatch, batchID)
+	var i Batch
+	err := row.Scan(
+		&i.ID,
+		&i.BatchID,
+		&i.UserID,
+		&i.Total,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,92 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: cache.sql
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+const deleteExpiredDetectionCache = `-- name: DeleteExpiredDetectionCache :execresult
+DELETE FROM detection_cache
+WHERE expires_at <= NOW()
+LIMIT ?
+`
+
+func (q *Queries) DeleteExpiredDetectionCache(ctx context.Context, limit int32) (sql.Result, error) {
+	return q.db.ExecContext(ctx, deleteExpiredDetectionCache, limit)
+}
+
+const getDetectionCache = `-- name: GetDetectionCache :one
+SELECT id, image_hash, detection_type, response_mode, prompt_version, model, result, expires_at, created_at
+FROM detection_cache
+WHERE image_hash = ? AND detection_type = ? AND response_mode = ? AND prompt_version = ? AND model = ?
+  AND expires_at > NOW()
+`
+
+type GetDetectionCacheParams struct {
+	ImageHash     string
+	DetectionType string
+	ResponseMode  string
+	PromptVersion string
+	Model         string
+}
+
+func (q *Queries) GetDetectionCache(ctx context.Context, arg GetDetectionCacheParams) (DetectionCache, error) {
+	row := q.db.QueryRowContext(ctx, getDetectionCache,
+		arg.ImageHash,
+		arg.DetectionType,
+		arg.ResponseMode,
+		arg.PromptVersion,
+		arg.Model,
+	)
+	var i DetectionCache
+	err := row.Scan(
+		&i.ID,
+		&i.ImageHash,
+		&i.DetectionType,
+		&i.ResponseMode,
+		&i.PromptVersion,
+		&i.Model,
+		&i.Result,
+		&i.ExpiresAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const upsertDetectionCache = `-- name: UpsertDetectionCache :exec
+INSERT INTO detection_cache (
+    image_hash, detection_type, response_mode, prompt_version, model, result, expires_at
+) VALUES (
+ ?, ?, ?, ?, ?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND)
+)
+ON DUPLICATE KEY UPDATE result = VALUES(result), expires_at = VALUES(expires_at)
+`
+
+type UpsertDetectionCacheParams struct {
+	ImageHash     string
+	DetectionType string
+	ResponseMode  string
+	PromptVersion string
+	Model         string
+	Result        json.RawMessage
+	TtlSeconds    interface{}
+}
+
+func (q *Queries) UpsertDetectionCache(ctx context.Context, arg UpsertDetectionCacheParams) error {
+	_, err := q.db.ExecContext(ctx, upsertDetectionCache,
+		arg.ImageHash,
+		arg.DetectionType,
+		arg.ResponseMode,
+		arg.PromptVersion,
+		arg.Model,
+		arg.Result,
+		arg.TtlSeconds,
+	)
+	return err
+}
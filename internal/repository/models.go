@@ -6,13 +6,108 @@ package repository
 
 import (
 	sql "database/sql"
+	"encoding/json"
+	"time"
 )
 
-type Task struct {
+type Batch struct {
 	ID        int32
-	TaskID    string
-	Status    string
-	Result    sql.NullString
+	BatchID   string
+	UserID    sql.NullString
+	Total     int32
 	CreatedAt sql.NullTime
 	UpdatedAt sql.NullTime
 }
+
+type DailyQuota struct {
+	Subject   string
+	Day       time.Time
+	Used      int32
+	UpdatedAt sql.NullTime
+}
+
+type DetectionCache struct {
+	ID            int64
+	ImageHash     string
+	DetectionType string
+	ResponseMode  string
+	PromptVersion string
+	Model         string
+	Result        json.RawMessage
+	ExpiresAt     time.Time
+	CreatedAt     sql.NullTime
+}
+
+type Task struct {
+	ID               int32
+	TaskID           string
+	UserID           sql.NullString
+	Status           string
+	ImageUrl         string
+	ImageKey         sql.NullString
+	DetectionType    string
+	ResponseMode     string
+	ForceRefresh     bool
+	ImageHash        sql.NullString
+	CallbackUrl      sql.NullString
+	BatchID          sql.NullString
+	Result           sql.NullString
+	ResultName       sql.NullString
+	OverallScore     sql.NullFloat64
+	Model            sql.NullString
+	PromptTokens     int32
+	CompletionTokens int32
+	LatencyMs        int32
+	Cost             float64
+	Attempts         int32
+	LastError        sql.NullString
+	AvailableAt      time.Time
+	LeaseOwner       sql.NullString
+	LeaseExpiresAt   sql.NullTime
+	CreatedAt        sql.NullTime
+	UpdatedAt        sql.NullTime
+}
+
+type Upload struct {
+	ID           int64
+	ImageHash    string
+	ObjectKey    string
+	ContentType  string
+	Size         int64
+	Width        int32
+	Height       int32
+	ThumbnailKey sql.NullString
+	DisplayKey   sql.NullString
+	Uploader     sql.NullString
+	CreatedAt    sql.NullTime
+}
+
+type UploadTicket struct {
+	ObjectKey   string
+	Uploader    string
+	ContentType string
+	Size        int64
+	CompletedAt sql.NullTime
+	CreatedAt   sql.NullTime
+}
+
+type WebhookDelivery struct {
+	ID         int64
+	TaskID     string
+	Url        string
+	Attempt    int32
+	StatusCode sql.NullInt32
+	Error      sql.NullString
+	Delivered  bool
+	DurationMs int32
+	CreatedAt  sql.NullTime
+}
+
+type WebhookJob struct {
+	ID            int64
+	TaskID        string
+	Url           string
+	Attempts      int32
+	NextAttemptAt time.Time
+	CreatedAt     sql.NullTime
+}
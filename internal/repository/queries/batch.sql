@@ -0,0 +1,11 @@
+-- name: CreateBatch :execresult
+INSERT INTO batches (
+    batch_id, user_id, total
+) VALUES (
+ ?, ?, ?
+);
+
+-- name: GetBatch :one
+SELECT *
+FROM batches
+WHERE batch_id = ?;
@@ -0,0 +1,19 @@
+-- name: GetDetectionCache :one
+SELECT *
+FROM detection_cache
+WHERE image_hash = ? AND detection_type = ? AND response_mode = ? AND prompt_version = ? AND model = ?
+  AND expires_at > NOW();
+
+-- name: UpsertDetectionCache :exec
+INSERT INTO detection_cache (
+    image_hash, detection_type, response_mode, prompt_version, model, result, expires_at
+) VALUES (
+ ?, ?, ?, ?, ?, ?, DATE_ADD(NOW(), INTERVAL sqlc.arg(ttl_seconds) SECOND)
+)
+ON DUPLICATE KEY UPDATE result = VALUES(result), expires_at = VALUES(expires_at);
+
+
+-- name: DeleteExpiredDetectionCache :execresult
+DELETE FROM detection_cache
+WHERE expires_at <= NOW()
+LIMIT ?;
@@ -0,0 +1,12 @@
+-- name: EnsureDailyQuota :exec
+INSERT IGNORE INTO daily_quotas (subject, day, used) VALUES (?, CURDATE(), 0);
+
+-- name: ConsumeDailyQuota :execresult
+UPDATE daily_quotas
+SET used = used + sqlc.arg(amount)
+WHERE subject = sqlc.arg(subject) AND day = CURDATE() AND used + sqlc.arg(amount) <= sqlc.arg(quota);
+
+-- name: GetDailyQuotaUsed :one
+SELECT used
+FROM daily_quotas
+WHERE subject = ? AND day = CURDATE();
@@ -1,8 +1,8 @@
 -- name: CreateTask :execresult
 INSERT INTO tasks (
-    task_id, status
+    task_id, user_id, status, image_url, image_key, detection_type, response_mode, force_refresh, callback_url, batch_id
 ) VALUES (
- ?, ?
+ ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
 );
 
 -- name: GetTask :one
@@ -10,10 +10,87 @@ SELECT *
 FROM tasks
 WHERE task_id = ?;
 
+-- name: ListBatchTasks :many
+SELECT *
+FROM tasks
+WHERE batch_id = ?
+ORDER BY id;
+
+-- name: ListUserTasks :many
+SELECT t.id, t.task_id, t.status, t.detection_type, t.result_name, t.overall_score, t.created_at, u.thumbnail_key
+FROM tasks t
+LEFT JOIN uploads u ON u.id = (
+    SELECT MAX(id) FROM uploads WHERE uploads.image_hash = t.image_hash
+)
+WHERE t.user_id = sqlc.arg(user_id)
+  AND t.id < sqlc.arg(before_id)
+  AND (sqlc.narg(status) IS NULL OR t.status = sqlc.narg(status))
+  AND (sqlc.narg(detection_type) IS NULL OR t.detection_type = sqlc.narg(detection_type))
+  AND (sqlc.narg(created_from) IS NULL OR t.created_at >= sqlc.narg(created_from))
+  AND (sqlc.narg(created_to) IS NULL OR t.created_at < sqlc.narg(created_to))
+  AND (sqlc.narg(name_pattern) IS NULL OR t.result_name LIKE sqlc.narg(name_pattern))
+ORDER BY t.id DESC
+LIMIT ?;
+
 -- name: UpdateTaskStatus :execresult
 UPDATE tasks 
 SET status = ? WHERE task_id = ?;
 
 -- name: UpdateTaskResult :exec
 UPDATE tasks 
-SET status = ?, result = ? WHERE task_id = ?;
\ No newline at end of file
+SET status = ?, result = ? WHERE task_id = ?;
+
+-- name: UpdateTaskImageHash :exec
+UPDATE tasks
+SET image_hash = ? WHERE task_id = ?;
+
+-- name: AddTaskUsage :exec
+UPDATE tasks
+SET model = ?, prompt_tokens = prompt_tokens + ?, completion_tokens = completion_tokens + ?,
+    latency_ms = latency_ms + ?, cost = cost + ?
+WHERE task_id = ?;
+
+-- name: GetNextPendingTask :one
+SELECT *
+FROM tasks
+WHERE status = 'pending' AND available_at <= NOW()
+ORDER BY id
+LIMIT 1
+FOR UPDATE SKIP LOCKED;
+
+-- name: LeaseTask :exec
+UPDATE tasks
+SET status = 'running', attempts = attempts + 1, lease_owner = sqlc.arg(lease_owner), lease_expires_at = DATE_ADD(NOW(), INTERVAL sqlc.arg(lease_seconds) SECOND)
+WHERE id = sqlc.arg(id);
+
+-- name: HeartbeatTask :execresult
+UPDATE tasks
+SET lease_expires_at = DATE_ADD(NOW(), INTERVAL sqlc.arg(lease_seconds) SECOND)
+WHERE task_id = sqlc.arg(task_id) AND status = 'running' AND lease_owner = sqlc.arg(lease_owner);
+
+-- name: ReleaseTask :execresult
+-- 进程正常退出时归还租约，本次领取没有真正执行完，不计入执行次数
+UPDATE tasks
+SET status = 'pending', attempts = attempts - 1, lease_owner = NULL, lease_expires_at = NULL
+WHERE task_id = ? AND status = 'running' AND lease_owner = ?;
+
+-- name: CancelTask :execresult
+UPDATE tasks
+SET status = 'cancelled', lease_owner = NULL, lease_expires_at = NULL
+WHERE task_id = ? AND status IN ('pending', 'running');
+
+-- name: RequeueExpiredTasks :execresult
+UPDATE tasks
+SET status = 'pending', lease_owner = NULL, lease_expires_at = NULL
+WHERE status = 'running' AND lease_expires_at < NOW();
+
+-- name: CompleteLeasedTask :execresult
+UPDATE tasks
+SET status = ?, result = ?, result_name = ?, overall_score = ?, last_error = ?, lease_owner = NULL, lease_expires_at = NULL
+WHERE task_id = ? AND status = 'running' AND lease_owner = ?;
+
+-- name: RetryLeasedTask :execresult
+UPDATE tasks
+SET status = 'pending', last_error = sqlc.arg(last_error), lease_owner = NULL, lease_expires_at = NULL,
+    available_at = DATE_ADD(NOW(), INTERVAL sqlc.arg(delay_seconds) SECOND)
+WHERE task_id = sqlc.arg(task_id) AND status = 'running' AND lease_owner = sqlc.arg(lease_owner);
@@ -0,0 +1,30 @@
+-- name: CreateUpload :exec
+INSERT INTO uploads (
+    image_hash, object_key, content_type, size, width, height, thumbnail_key, display_key, uploader
+) VALUES (
+ ?, ?, ?, ?, ?, ?, ?, ?, ?
+);
+
+-- name: GetUploadByHash :one
+SELECT *
+FROM uploads
+WHERE image_hash = ?
+ORDER BY id DESC
+LIMIT 1;
+
+-- name: CreateUploadTicket :exec
+INSERT INTO upload_tickets (
+    object_key, uploader, content_type, size
+) VALUES (
+ ?, ?, ?, ?
+);
+
+-- name: GetUploadTicket :one
+SELECT *
+FROM upload_tickets
+WHERE object_key = ?;
+
+-- name: CompleteUploadTicket :execresult
+UPDATE upload_tickets
+SET completed_at = NOW()
+WHERE object_key = ? AND completed_at IS NULL;
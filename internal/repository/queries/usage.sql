@@ -0,0 +1,35 @@
+-- name: SummarizeUsageByModel :many
+SELECT model AS group_key,
+    COUNT(*) AS tasks,
+    CAST(SUM(prompt_tokens) AS SIGNED) AS prompt_tokens,
+    CAST(SUM(completion_tokens) AS SIGNED) AS completion_tokens,
+    CAST(SUM(latency_ms) AS SIGNED) AS latency_ms,
+    CAST(SUM(cost) AS DOUBLE) AS cost
+FROM tasks
+WHERE model IS NOT NULL AND created_at >= sqlc.arg(created_from) AND created_at < sqlc.arg(created_to)
+GROUP BY model
+ORDER BY group_key;
+
+-- name: SummarizeUsageByUser :many
+SELECT user_id AS group_key,
+    COUNT(*) AS tasks,
+    CAST(SUM(prompt_tokens) AS SIGNED) AS prompt_tokens,
+    CAST(SUM(completion_tokens) AS SIGNED) AS completion_tokens,
+    CAST(SUM(latency_ms) AS SIGNED) AS latency_ms,
+    CAST(SUM(cost) AS DOUBLE) AS cost
+FROM tasks
+WHERE model IS NOT NULL AND created_at >= sqlc.arg(created_from) AND created_at < sqlc.arg(created_to)
+GROUP BY user_id
+ORDER BY group_key;
+
+-- name: SummarizeUsageByDay :many
+SELECT DATE(created_at) AS group_key,
+    COUNT(*) AS tasks,
+    CAST(SUM(prompt_tokens) AS SIGNED) AS prompt_tokens,
+    CAST(SUM(completion_tokens) AS SIGNED) AS completion_tokens,
+    CAST(SUM(latency_ms) AS SIGNED) AS latency_ms,
+    CAST(SUM(cost) AS DOUBLE) AS cost
+FROM tasks
+WHERE model IS NOT NULL AND created_at >= sqlc.arg(created_from) AND created_at < sqlc.arg(created_to)
+GROUP BY DATE(created_at)
+ORDER BY group_key;
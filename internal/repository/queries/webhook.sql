@@ -0,0 +1,36 @@
+-- name: CreateWebhookDelivery :execresult
+INSERT INTO webhook_deliveries (
+    task_id, url, attempt, status_code, error, delivered, duration_ms
+) VALUES (
+ ?, ?, ?, ?, ?, ?, ?
+);
+
+
+-- name: CreateWebhookJob :exec
+INSERT INTO webhook_jobs (
+    task_id, url
+) VALUES (
+ ?, ?
+);
+
+-- name: GetDueWebhookJob :one
+SELECT *
+FROM webhook_jobs
+WHERE next_attempt_at <= NOW()
+ORDER BY next_attempt_at
+LIMIT 1
+FOR UPDATE SKIP LOCKED;
+
+-- name: LeaseWebhookJob :exec
+UPDATE webhook_jobs
+SET attempts = attempts + 1, next_attempt_at = DATE_ADD(NOW(), INTERVAL sqlc.arg(lease_seconds) SECOND)
+WHERE id = sqlc.arg(id);
+
+-- name: RescheduleWebhookJob :exec
+UPDATE webhook_jobs
+SET next_attempt_at = DATE_ADD(NOW(), INTERVAL sqlc.arg(delay_seconds) SECOND)
+WHERE id = sqlc.arg(id);
+
+-- name: DeleteWebhookJob :exec
+DELETE FROM webhook_jobs
+WHERE id = ?;
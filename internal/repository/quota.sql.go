@@ -0,0 +1,54 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: quota.sql
+
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+const consumeDailyQuota = `-- name: ConsumeDailyQuota :execresult
+UPDATE daily_quotas
+SET used = used + ?
+WHERE subject = ? AND day = CURDATE() AND used + ? <= ?
+`
+
+type ConsumeDailyQuotaParams struct {
+	Amount  int32
+	Subject string
+	Quota   int32
+}
+
+func (q *Queries) ConsumeDailyQuota(ctx context.Context, arg ConsumeDailyQuotaParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, consumeDailyQuota,
+		arg.Amount,
+		arg.Subject,
+		arg.Amount,
+		arg.Quota,
+	)
+}
+
+const ensureDailyQuota = `-- name: EnsureDailyQuota :exec
+INSERT IGNORE INTO daily_quotas (subject, day, used) VALUES (?, CURDATE(), 0)
+`
+
+func (q *Queries) EnsureDailyQuota(ctx context.Context, subject string) error {
+	_, err := q.db.ExecContext(ctx, ensureDailyQuota, subject)
+	return err
+}
+
+const getDailyQuotaUsed = `-- name: GetDailyQuotaUsed :one
+SELECT used
+FROM daily_quotas
+WHERE subject = ? AND day = CURDATE()
+`
+
+func (q *Queries) GetDailyQuotaUsed(ctx context.Context, subject string) (int32, error) {
+	row := q.db.QueryRowContext(ctx, getDailyQuotaUsed, subject)
+	var used int32
+	err := row.Scan(&used)
+	return used, err
+}
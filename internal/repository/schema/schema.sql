@@ -1,8 +1,115 @@
 CREATE TABLE tasks (
     id INT AUTO_INCREMENT PRIMARY KEY,      -- 任务 ID（自增）
     task_id CHAR(36) NOT NULL UNIQUE,       -- 任务唯一标识（UUID）
-    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- 任务状态: pending, running, success, failed
+    user_id VARCHAR(64) DEFAULT NULL,       -- 创建任务的用户
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- 任务状态: pending, running, success, failed, cancelled
+    image_url VARCHAR(2048) NOT NULL DEFAULT '', -- 待识别的图片地址，请求直接携带的图片为空
+    image_key VARCHAR(255) DEFAULT NULL,    -- 请求直接携带的图片在对象存储中的 key，处理时再读取
+    detection_type VARCHAR(32) NOT NULL,    -- 检测类型
+    response_mode VARCHAR(16) NOT NULL DEFAULT 'single', -- 返回形式: single, multi
+    force_refresh BOOLEAN NOT NULL DEFAULT FALSE, -- 是否跳过结果缓存
+    image_hash CHAR(64) DEFAULT NULL,       -- 图片内容的 SHA-256
+    callback_url VARCHAR(1024) DEFAULT NULL, -- 任务结束后回调的地址
+    batch_id CHAR(36) DEFAULT NULL,         -- 所属批次，单张识别时为空
     result JSON DEFAULT NULL,               -- 任务结果（JSON 类型）
+    result_name VARCHAR(255) DEFAULT NULL,  -- 识别出的物品名称，多物品识别时以「、」连接
+    overall_score DOUBLE DEFAULT NULL,      -- 综合评分，多物品识别时取平均值
+    model VARCHAR(64) DEFAULT NULL,         -- 实际调用的模型，命中缓存时为空
+    prompt_tokens INT NOT NULL DEFAULT 0,   -- 输入 token 数，多次调用时累加
+    completion_tokens INT NOT NULL DEFAULT 0, -- 输出 token 数，多次调用时累加
+    latency_ms INT NOT NULL DEFAULT 0,      -- 模型调用耗时（毫秒），多次调用时累加
+    cost DOUBLE NOT NULL DEFAULT 0,         -- 按价格表计算的费用，多次调用时累加
+    attempts INT NOT NULL DEFAULT 0,        -- 已执行次数
+    last_error JSON DEFAULT NULL,           -- 最近一次失败原因
+    available_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- 最早可被领取的时间，用于重试退避
+    lease_owner VARCHAR(64) DEFAULT NULL,   -- 持有任务租约的 worker
+    lease_expires_at TIMESTAMP NULL DEFAULT NULL, -- 租约过期时间，过期后任务会被重新排队
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- 任务创建时间
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP -- 任务更新时间
-);
\ No newline at end of file
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, -- 任务更新时间
+    INDEX idx_tasks_status_available (status, available_at),
+    INDEX idx_tasks_status_lease (status, lease_expires_at),
+    INDEX idx_tasks_batch_id (batch_id),
+    INDEX idx_tasks_user_status (user_id, status),
+    INDEX idx_tasks_user_type (user_id, detection_type),
+    INDEX idx_tasks_user_created (user_id, created_at),
+    INDEX idx_tasks_created_at (created_at)
+);
+
+CREATE TABLE batches (
+    id INT AUTO_INCREMENT PRIMARY KEY,      -- 批次 ID（自增）
+    batch_id CHAR(36) NOT NULL UNIQUE,      -- 批次唯一标识（UUID）
+    user_id VARCHAR(64) DEFAULT NULL,       -- 创建批次的用户
+    total INT NOT NULL,                     -- 批次内的任务数
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- 批次创建时间
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP -- 批次更新时间
+);
+
+CREATE TABLE detection_cache (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,   -- 缓存 ID（自增）
+    image_hash CHAR(64) NOT NULL,           -- 图片内容的 SHA-256
+    detection_type VARCHAR(32) NOT NULL,    -- 检测类型
+    response_mode VARCHAR(16) NOT NULL,     -- 返回形式
+    prompt_version VARCHAR(16) NOT NULL,    -- 提示词版本
+    model VARCHAR(64) NOT NULL,             -- 模型名称
+    result JSON NOT NULL,                   -- 识别结果
+    expires_at TIMESTAMP NOT NULL,          -- 过期时间
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- 缓存创建时间
+    UNIQUE KEY uk_detection_cache_key (image_hash, detection_type, response_mode, prompt_version, model),
+    INDEX idx_detection_cache_expires_at (expires_at)
+);
+
+CREATE TABLE webhook_deliveries (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,   -- 投递记录 ID（自增）
+    task_id CHAR(36) NOT NULL,              -- 关联的任务
+    url VARCHAR(1024) NOT NULL,             -- 回调地址
+    attempt INT NOT NULL,                   -- 第几次投递
+    status_code INT DEFAULT NULL,           -- 回调方返回的 HTTP 状态码
+    error TEXT DEFAULT NULL,                -- 投递失败原因
+    delivered BOOLEAN NOT NULL DEFAULT FALSE, -- 是否投递成功
+    duration_ms INT NOT NULL DEFAULT 0,     -- 请求耗时（毫秒）
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- 投递时间
+    INDEX idx_webhook_deliveries_task_id (task_id)
+);
+
+CREATE TABLE webhook_jobs (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,   -- 回调任务 ID（自增）
+    task_id CHAR(36) NOT NULL UNIQUE,       -- 关联的任务，投递成功或放弃后删除
+    url VARCHAR(1024) NOT NULL,             -- 回调地址
+    attempts INT NOT NULL DEFAULT 0,        -- 已投递次数
+    next_attempt_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP, -- 下次投递时间，投递期间作为租约向后推迟
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- 创建时间
+    INDEX idx_webhook_jobs_next_attempt_at (next_attempt_at)
+);
+
+CREATE TABLE uploads (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,   -- 上传记录 ID（自增）
+    image_hash CHAR(64) NOT NULL,           -- 图片内容的 SHA-256
+    object_key VARCHAR(255) NOT NULL,       -- 对象存储中的 key
+    content_type VARCHAR(32) NOT NULL,      -- 图片类型
+    size BIGINT NOT NULL,                   -- 图片字节数
+    width INT NOT NULL,                     -- 图片宽度
+    height INT NOT NULL,                    -- 图片高度
+    thumbnail_key VARCHAR(255) DEFAULT NULL, -- 缩略图的 key，无法解码的格式为空
+    display_key VARCHAR(255) DEFAULT NULL,  -- 展示图的 key，无法解码的格式为空
+    uploader VARCHAR(64) DEFAULT NULL,      -- 上传者
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, -- 上传时间
+    INDEX idx_uploads_image_hash (image_hash),
+    INDEX idx_uploads_uploader (uploader, created_at)
+);
+
+CREATE TABLE daily_quotas (
+    subject VARCHAR(128) NOT NULL,          -- 计数对象：user:<user_id>、ip:<ip> 或 global
+    day DATE NOT NULL,                      -- 日期，按数据库时区的 CURDATE()
+    used INT NOT NULL DEFAULT 0,            -- 当天已使用的识别次数
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP, -- 更新时间
+    PRIMARY KEY (subject, day)
+);
+
+CREATE TABLE upload_tickets (
+    object_key VARCHAR(255) NOT NULL PRIMARY KEY, -- 凭证允许上传的 key
+    uploader VARCHAR(64) NOT NULL,          -- 申请凭证的用户，只有该用户可以确认上传
+    content_type VARCHAR(32) NOT NULL,      -- 凭证签名的图片类型
+    size BIGINT NOT NULL,                   -- 凭证签名的字节数
+    completed_at TIMESTAMP NULL DEFAULT NULL, -- 确认上传的时间
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP -- 签发时间
+);
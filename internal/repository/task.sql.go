@@ -10,25 +10,154 @@ import (
 	sql "database/sql"
 )
 
+const addTaskUsage = `-- name: AddTaskUsage :exec
+UPDATE tasks
+SET model = ?, prompt_tokens = prompt_tokens + ?, completion_tokens = completion_tokens + ?,
+    latency_ms = latency_ms + ?, cost = cost + ?
+WHERE task_id = ?
+`
+
+type AddTaskUsageParams struct {
+	Model            sql.NullString
+	PromptTokens     int32
+	CompletionTokens int32
+	LatencyMs        int32
+	Cost             float64
+	TaskID           string
+}
+
+func (q *Queries) AddTaskUsage(ctx context.Context, arg AddTaskUsageParams) error {
+	_, err := q.db.ExecContext(ctx, addTaskUsage,
+		arg.Model,
+		arg.PromptTokens,
+		arg.CompletionTokens,
+		arg.LatencyMs,
+		arg.Cost,
+		arg.TaskID,
+	)
+	return err
+}
+
+const cancelTask = `-- name: CancelTask :execresult
+UPDATE tasks
+SET status = 'cancelled', lease_owner = NULL, lease_expires_at = NULL
+WHERE task_id = ? AND status IN ('pending', 'running')
+`
+
+func (q *Queries) CancelTask(ctx context.Context, taskID string) (sql.Result, error) {
+	return q.db.ExecContext(ctx, cancelTask, taskID)
+}
+
+const completeLeasedTask = `-- name: CompleteLeasedTask :execresult
+UPDATE tasks
+SET status = ?, result = ?, result_name = ?, overall_score = ?, last_error = ?, lease_owner = NULL, lease_expires_at = NULL
+WHERE task_id = ? AND status = 'running' AND lease_owner = ?
+`
+
+type CompleteLeasedTaskParams struct {
+	Status       string
+	Result       sql.NullString
+	ResultName   sql.NullString
+	OverallScore sql.NullFloat64
+	LastError    sql.NullString
+	TaskID       string
+	LeaseOwner   sql.NullString
+}
+
+func (q *Queries) CompleteLeasedTask(ctx context.Context, arg CompleteLeasedTaskParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, completeLeasedTask,
+		arg.Status,
+		arg.Result,
+		arg.ResultName,
+		arg.OverallScore,
+		arg.LastError,
+		arg.TaskID,
+		arg.LeaseOwner,
+	)
+}
+
 const createTask = `-- name: CreateTask :execresult
 INSERT INTO tasks (
-    task_id, status
+    task_id, user_id, status, image_url, image_key, detection_type, response_mode, force_refresh, callback_url, batch_id
 ) VALUES (
- ?, ?
+ ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
 )
 `
 
 type CreateTaskParams struct {
-	TaskID string
-	Status string
+	TaskID        string
+	UserID        sql.NullString
+	Status        string
+	ImageUrl      string
+	ImageKey      sql.NullString
+	DetectionType string
+	ResponseMode  string
+	ForceRefresh  bool
+	CallbackUrl   sql.NullString
+	BatchID       sql.NullString
 }
 
 func (q *Queries) CreateTask(ctx context.Context, arg CreateTaskParams) (sql.Result, error) {
-	return q.db.ExecContext(ctx, createTask, arg.TaskID, arg.Status)
+	return q.db.ExecContext(ctx, createTask,
+		arg.TaskID,
+		arg.UserID,
+		arg.Status,
+		arg.ImageUrl,
+		arg.ImageKey,
+		arg.DetectionType,
+		arg.ResponseMode,
+		arg.ForceRefresh,
+		arg.CallbackUrl,
+		arg.BatchID,
+	)
+}
+
+const getNextPendingTask = `-- name: GetNextPendingTask :one
+SELECT id, task_id, user_id, status, image_url, image_key, detection_type, response_mode, force_refresh, image_hash, callback_url, batch_id, result, result_name, overall_score, model, prompt_tokens, completion_tokens, latency_ms, cost, attempts, last_error, available_at, lease_owner, lease_expires_at, created_at, updated_at
+FROM tasks
+WHERE status = 'pending' AND available_at <= NOW()
+ORDER BY id
+LIMIT 1
+FOR UPDATE SKIP LOCKED
+`
+
+func (q *Queries) GetNextPendingTask(ctx context.Context) (Task, error) {
+	row := q.db.QueryRowContext(ctx, getNextPendingTask)
+	var i Task
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.UserID,
+		&i.Status,
+		&i.ImageUrl,
+		&i.ImageKey,
+		&i.DetectionType,
+		&i.ResponseMode,
+		&i.ForceRefresh,
+		&i.ImageHash,
+		&i.CallbackUrl,
+		&i.BatchID,
+		&i.Result,
+		&i.ResultName,
+		&i.OverallScore,
+		&i.Model,
+		&i.PromptTokens,
+		&i.CompletionTokens,
+		&i.LatencyMs,
+		&i.Cost,
+		&i.Attempts,
+		&i.LastError,
+		&i.AvailableAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
 }
 
 const getTask = `-- name: GetTask :one
-SELECT id, task_id, status, result, created_at, updated_at
+SELECT id, task_id, user_id, status, image_url, image_key, detection_type, response_mode, force_refresh, image_hash, callback_url, batch_id, result, result_name, overall_score, model, prompt_tokens, completion_tokens, latency_ms, cost, attempts, last_error, available_at, lease_owner, lease_expires_at, created_at, updated_at
 FROM tasks
 WHERE task_id = ?
 `
@@ -39,14 +168,275 @@ func (q *Queries) GetTask(ctx context.Context, taskID string) (Task, error) {
 	err := row.Scan(
 		&i.ID,
 		&i.TaskID,
+		&i.UserID,
 		&i.Status,
+		&i.ImageUrl,
+		&i.ImageKey,
+		&i.DetectionType,
+		&i.ResponseMode,
+		&i.ForceRefresh,
+		&i.ImageHash,
+		&i.CallbackUrl,
+		&i.BatchID,
 		&i.Result,
+		&i.ResultName,
+		&i.OverallScore,
+		&i.Model,
+		&i.PromptTokens,
+		&i.CompletionTokens,
+		&i.LatencyMs,
+		&i.Cost,
+		&i.Attempts,
+		&i.LastError,
+		&i.AvailableAt,
+		&i.LeaseOwner,
+		&i.LeaseExpiresAt,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 	)
 	return i, err
 }
 
+const heartbeatTask = `-- name: HeartbeatTask :execresult
+UPDATE tasks
+SET lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+WHERE task_id = ? AND status = 'running' AND lease_owner = ?
+`
+
+type HeartbeatTaskParams struct {
+	LeaseSeconds interface{}
+	TaskID       string
+	LeaseOwner   sql.NullString
+}
+
+func (q *Queries) HeartbeatTask(ctx context.Context, arg HeartbeatTaskParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, heartbeatTask, arg.LeaseSeconds, arg.TaskID, arg.LeaseOwner)
+}
+
+const leaseTask = `-- name: LeaseTask :exec
+UPDATE tasks
+SET status = 'running', attempts = attempts + 1, lease_owner = ?, lease_expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+WHERE id = ?
+`
+
+type LeaseTaskParams struct {
+	LeaseOwner   sql.NullString
+	LeaseSeconds interface{}
+	ID           int32
+}
+
+func (q *Queries) LeaseTask(ctx context.Context, arg LeaseTaskParams) error {
+	_, err := q.db.ExecContext(ctx, leaseTask, arg.LeaseOwner, arg.LeaseSeconds, arg.ID)
+	return err
+}
+
+const listBatchTasks = `-- name: ListBatchTasks :many
+SELECT id, task_id, user_id, status, image_url, image_key, detection_type, response_mode, force_refresh, image_hash, callback_url, batch_id, result, result_name, overall_score, model, prompt_tokens, completion_tokens, latency_ms, cost, attempts, last_error, available_at, lease_owner, lease_expires_at, created_at, updated_at
+FROM tasks
+WHERE batch_id = ?
+ORDER BY id
+`
+
+func (q *Queries) ListBatchTasks(ctx context.Context, batchID sql.NullString) ([]Task, error) {
+	rows, err := q.db.QueryContext(ctx, listBatchTasks, batchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Task
+	for rows.Next() {
+		var i Task
+		if err := rows.Scan(
+			&i.ID,
+			&i.TaskID,
+			&i.UserID,
+			&i.Status,
+			&i.ImageUrl,
+			&i.ImageKey,
+			&i.DetectionType,
+			&i.ResponseMode,
+			&i.ForceRefresh,
+			&i.ImageHash,
+			&i.CallbackUrl,
+			&i.BatchID,
+			&i.Result,
+			&i.ResultName,
+			&i.OverallScore,
+			&i.Model,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.LatencyMs,
+			&i.Cost,
+			&i.Attempts,
+			&i.LastError,
+			&i.AvailableAt,
+			&i.LeaseOwner,
+			&i.LeaseExpiresAt,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserTasks = `-- name: ListUserTasks :many
+SELECT t.id, t.task_id, t.status, t.detection_type, t.result_name, t.overall_score, t.created_at, u.thumbnail_key
+FROM tasks t
+LEFT JOIN uploads u ON u.id = (
+    SELECT MAX(id) FROM uploads WHERE uploads.image_hash = t.image_hash
+)
+WHERE t.user_id = ?
+  AND t.id < ?
+  AND (? IS NULL OR t.status = ?)
+  AND (? IS NULL OR t.detection_type = ?)
+  AND (? IS NULL OR t.created_at >= ?)
+  AND (? IS NULL OR t.created_at < ?)
+  AND (? IS NULL OR t.result_name LIKE ?)
+ORDER BY t.id DESC
+LIMIT ?
+`
+
+type ListUserTasksParams struct {
+	UserID        sql.NullString
+	BeforeID      int32
+	Status        sql.NullString
+	DetectionType sql.NullString
+	CreatedFrom   sql.NullTime
+	CreatedTo     sql.NullTime
+	NamePattern   sql.NullString
+	Limit         int32
+}
+
+type ListUserTasksRow struct {
+	ID            int32
+	TaskID        string
+	Status        string
+	DetectionType string
+	ResultName    sql.NullString
+	OverallScore  sql.NullFloat64
+	CreatedAt     sql.NullTime
+	ThumbnailKey  sql.NullString
+}
+
+func (q *Queries) ListUserTasks(ctx context.Context, arg ListUserTasksParams) ([]ListUserTasksRow, error) {
+	rows, err := q.db.QueryContext(ctx, listUserTasks,
+		arg.UserID,
+		arg.BeforeID,
+		arg.Status,
+		arg.Status,
+		arg.DetectionType,
+		arg.DetectionType,
+		arg.CreatedFrom,
+		arg.CreatedFrom,
+		arg.CreatedTo,
+		arg.CreatedTo,
+		arg.NamePattern,
+		arg.NamePattern,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserTasksRow
+	for rows.Next() {
+		var i ListUserTasksRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.TaskID,
+			&i.Status,
+			&i.DetectionType,
+			&i.ResultName,
+			&i.OverallScore,
+			&i.CreatedAt,
+			&i.ThumbnailKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const releaseTask = `-- name: ReleaseTask :execresult
+UPDATE tasks
+SET status = 'pending', attempts = attempts - 1, lease_owner = NULL, lease_expires_at = NULL
+WHERE task_id = ? AND status = 'running' AND lease_owner = ?
+`
+
+type ReleaseTaskParams struct {
+	TaskID     string
+	LeaseOwner sql.NullString
+}
+
+// 进程正常退出时归还租约，本次领取没有真正执行完，不计入执行次数
+func (q *Queries) ReleaseTask(ctx context.Context, arg ReleaseTaskParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, releaseTask, arg.TaskID, arg.LeaseOwner)
+}
+
+const requeueExpiredTasks = `-- name: RequeueExpiredTasks :execresult
+UPDATE tasks
+SET status = 'pending', lease_owner = NULL, lease_expires_at = NULL
+WHERE status = 'running' AND lease_expires_at < NOW()
+`
+
+func (q *Queries) RequeueExpiredTasks(ctx context.Context) (sql.Result, error) {
+	return q.db.ExecContext(ctx, requeueExpiredTasks)
+}
+
+const retryLeasedTask = `-- name: RetryLeasedTask :execresult
+UPDATE tasks
+SET status = 'pending', last_error = ?, lease_owner = NULL, lease_expires_at = NULL,
+    available_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+WHERE task_id = ? AND status = 'running' AND lease_owner = ?
+`
+
+type RetryLeasedTaskParams struct {
+	LastError    sql.NullString
+	DelaySeconds interface{}
+	TaskID       string
+	LeaseOwner   sql.NullString
+}
+
+func (q *Queries) RetryLeasedTask(ctx context.Context, arg RetryLeasedTaskParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, retryLeasedTask,
+		arg.LastError,
+		arg.DelaySeconds,
+		arg.TaskID,
+		arg.LeaseOwner,
+	)
+}
+
+const updateTaskImageHash = `-- name: UpdateTaskImageHash :exec
+UPDATE tasks
+SET image_hash = ? WHERE task_id = ?
+`
+
+type UpdateTaskImageHashParams struct {
+	ImageHash sql.NullString
+	TaskID    string
+}
+
+func (q *Queries) UpdateTaskImageHash(ctx context.Context, arg UpdateTaskImageHashParams) error {
+	_, err := q.db.ExecContext(ctx, updateTaskImageHash, arg.ImageHash, arg.TaskID)
+	return err
+}
+
 const updateTaskResult = `-- name: UpdateTaskResult :exec
 UPDATE tasks 
 SET status = ?, result = ? WHERE task_id = ?
@@ -0,0 +1,128 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: upload.sql
+
+package repository
+
+import (
+	"context"
+	sql "database/sql"
+)
+
+const completeUploadTicket = `-- name: CompleteUploadTicket :execresult
+UPDATE upload_tickets
+SET completed_at = NOW()
+WHERE object_key = ? AND completed_at IS NULL
+`
+
+func (q *Queries) CompleteUploadTicket(ctx context.Context, objectKey string) (sql.Result, error) {
+	return q.db.ExecContext(ctx, completeUploadTicket, objectKey)
+}
+
+const createUpload = `-- name: CreateUpload :exec
+INSERT INTO uploads (
+    image_hash, object_key, content_type, size, width, height, thumbnail_key, display_key, uploader
+) VALUES (
+ ?, ?, ?, ?, ?, ?, ?, ?, ?
+)
+`
+
+type CreateUploadParams struct {
+	ImageHash    string
+	ObjectKey    string
+	ContentType  string
+	Size         int64
+	Width        int32
+	Height       int32
+	ThumbnailKey sql.NullString
+	DisplayKey   sql.NullString
+	Uploader     sql.NullString
+}
+
+func (q *Queries) CreateUpload(ctx context.Context, arg CreateUploadParams) error {
+	_, err := q.db.ExecContext(ctx, createUpload,
+		arg.ImageHash,
+		arg.ObjectKey,
+		arg.ContentType,
+		arg.Size,
+		arg.Width,
+		arg.Height,
+		arg.ThumbnailKey,
+		arg.DisplayKey,
+		arg.Uploader,
+	)
+	return err
+}
+
+const createUploadTicket = `-- name: CreateUploadTicket :exec
+INSERT INTO upload_tickets (
+    object_key, uploader, content_type, size
+) VALUES (
+ ?, ?, ?, ?
+)
+`
+
+type CreateUploadTicketParams struct {
+	ObjectKey   string
+	Uploader    string
+	ContentType string
+	Size        int64
+}
+
+func (q *Queries) CreateUploadTicket(ctx context.Context, arg CreateUploadTicketParams) error {
+	_, err := q.db.ExecContext(ctx, createUploadTicket,
+		arg.ObjectKey,
+		arg.Uploader,
+		arg.ContentType,
+		arg.Size,
+	)
+	return err
+}
+
+const getUploadByHash = `-- name: GetUploadByHash :one
+SELECT id, image_hash, object_key, content_type, size, width, height, thumbnail_key, display_key, uploader, created_at
+FROM uploads
+WHERE image_hash = ?
+ORDER BY id DESC
+LIMIT 1
+`
+
+func (q *Queries) GetUploadByHash(ctx context.Context, imageHash string) (Upload, error) {
+	row := q.db.QueryRowContext(ctx, getUploadByHash, imageHash)
+	var i Upload
+	err := row.Scan(
+		&i.ID,
+		&i.ImageHash,
+		&i.ObjectKey,
+		&i.ContentType,
+		&i.Size,
+		&i.Width,
+		&i.Height,
+		&i.ThumbnailKey,
+		&i.DisplayKey,
+		&i.Uploader,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getUploadTicket = `-- name: GetUploadTicket :one
+SELECT object_key, uploader, content_type, size, completed_at, created_at
+FROM upload_tickets
+WHERE object_key = ?
+`
+
+func (q *Queries) GetUploadTicket(ctx context.Context, objectKey string) (UploadTicket, error) {
+	row := q.db.QueryRowContext(ctx, getUploadTicket, objectKey)
+	var i UploadTicket
+	err := row.Scan(
+		&i.ObjectKey,
+		&i.Uploader,
+		&i.ContentType,
+		&i.Size,
+		&i.CompletedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
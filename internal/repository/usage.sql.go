@@ -0,0 +1,183 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: usage.sql
+
+package repository
+
+import (
+	"context"
+	sql "database/sql"
+	"time"
+)
+
+const summarizeUsageByDay = `-- name: SummarizeUsageByDay :many
+SELECT DATE(created_at) AS group_key,
+    COUNT(*) AS tasks,
+    CAST(SUM(prompt_tokens) AS SIGNED) AS prompt_tokens,
+    CAST(SUM(completion_tokens) AS SIGNED) AS completion_tokens,
+    CAST(SUM(latency_ms) AS SIGNED) AS latency_ms,
+    CAST(SUM(cost) AS DOUBLE) AS cost
+FROM tasks
+WHERE model IS NOT NULL AND created_at >= ? AND created_at < ?
+GROUP BY DATE(created_at)
+ORDER BY group_key
+`
+
+type SummarizeUsageByDayParams struct {
+	CreatedFrom sql.NullTime
+	CreatedTo   sql.NullTime
+}
+
+type SummarizeUsageByDayRow struct {
+	GroupKey         time.Time
+	Tasks            int64
+	PromptTokens     int64
+	CompletionTokens int64
+	LatencyMs        int64
+	Cost             float64
+}
+
+func (q *Queries) SummarizeUsageByDay(ctx context.Context, arg SummarizeUsageByDayParams) ([]SummarizeUsageByDayRow, error) {
+	rows, err := q.db.QueryContext(ctx, summarizeUsageByDay, arg.CreatedFrom, arg.CreatedTo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SummarizeUsageByDayRow
+	for rows.Next() {
+		var i SummarizeUsageByDayRow
+		if err := rows.Scan(
+			&i.GroupKey,
+			&i.Tasks,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.LatencyMs,
+			&i.Cost,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const summarizeUsageByModel = `-- name: SummarizeUsageByModel :many
+SELECT model AS group_key,
+    COUNT(*) AS tasks,
+    CAST(SUM(prompt_tokens) AS SIGNED) AS prompt_tokens,
+    CAST(SUM(completion_tokens) AS SIGNED) AS completion_tokens,
+    CAST(SUM(latency_ms) AS SIGNED) AS latency_ms,
+    CAST(SUM(cost) AS DOUBLE) AS cost
+FROM tasks
+WHERE model IS NOT NULL AND created_at >= ? AND created_at < ?
+GROUP BY model
+ORDER BY group_key
+`
+
+type SummarizeUsageByModelParams struct {
+	CreatedFrom sql.NullTime
+	CreatedTo   sql.NullTime
+}
+
+type SummarizeUsageByModelRow struct {
+	GroupKey         sql.NullString
+	Tasks            int64
+	PromptTokens     int64
+	CompletionTokens int64
+	LatencyMs        int64
+	Cost             float64
+}
+
+func (q *Queries) SummarizeUsageByModel(ctx context.Context, arg SummarizeUsageByModelParams) ([]SummarizeUsageByModelRow, error) {
+	rows, err := q.db.QueryContext(ctx, summarizeUsageByModel, arg.CreatedFrom, arg.CreatedTo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SummarizeUsageByModelRow
+	for rows.Next() {
+		var i SummarizeUsageByModelRow
+		if err := rows.Scan(
+			&i.GroupKey,
+			&i.Tasks,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.LatencyMs,
+			&i.Cost,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const summarizeUsageByUser = `-- name: SummarizeUsageByUser :many
+SELECT user_id AS group_key,
+    COUNT(*) AS tasks,
+    CAST(SUM(prompt_tokens) AS SIGNED) AS prompt_tokens,
+    CAST(SUM(completion_tokens) AS SIGNED) AS completion_tokens,
+    CAST(SUM(latency_ms) AS SIGNED) AS latency_ms,
+    CAST(SUM(cost) AS DOUBLE) AS cost
+FROM tasks
+WHERE model IS NOT NULL AND created_at >= ? AND created_at < ?
+GROUP BY user_id
+ORDER BY group_key
+`
+
+type SummarizeUsageByUserParams struct {
+	CreatedFrom sql.NullTime
+	CreatedTo   sql.NullTime
+}
+
+type SummarizeUsageByUserRow struct {
+	GroupKey         sql.NullString
+	Tasks            int64
+	PromptTokens     int64
+	CompletionTokens int64
+	LatencyMs        int64
+	Cost             float64
+}
+
+func (q *Queries) SummarizeUsageByUser(ctx context.Context, arg SummarizeUsageByUserParams) ([]SummarizeUsageByUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, summarizeUsageByUser, arg.CreatedFrom, arg.CreatedTo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SummarizeUsageByUserRow
+	for rows.Next() {
+		var i SummarizeUsageByUserRow
+		if err := rows.Scan(
+			&i.GroupKey,
+			&i.Tasks,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.LatencyMs,
+			&i.Cost,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,124 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.27.0
+// source: webhook.sql
+
+package repository
+
+import (
+	"context"
+	sql "database/sql"
+)
+
+const createWebhookDelivery = `-- name: CreateWebhookDelivery :execresult
+INSERT INTO webhook_deliveries (
+    task_id, url, attempt, status_code, error, delivered, duration_ms
+) VALUES (
+ ?, ?, ?, ?, ?, ?, ?
+)
+`
+
+type CreateWebhookDeliveryParams struct {
+	TaskID     string
+	Url        string
+	Attempt    int32
+	StatusCode sql.NullInt32
+	Error      sql.NullString
+	Delivered  bool
+	DurationMs int32
+}
+
+func (q *Queries) CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) (sql.Result, error) {
+	return q.db.ExecContext(ctx, createWebhookDelivery,
+		arg.TaskID,
+		arg.Url,
+		arg.Attempt,
+		arg.StatusCode,
+		arg.Error,
+		arg.Delivered,
+		arg.DurationMs,
+	)
+}
+
+const createWebhookJob = `-- name: CreateWebhookJob :exec
+INSERT INTO webhook_jobs (
+    task_id, url
+) VALUES (
+ ?, ?
+)
+`
+
+type CreateWebhookJobParams struct {
+	TaskID string
+	Url    string
+}
+
+func (q *Queries) CreateWebhookJob(ctx context.Context, arg CreateWebhookJobParams) error {
+	_, err := q.db.ExecContext(ctx, createWebhookJob, arg.TaskID, arg.Url)
+	return err
+}
+
+const deleteWebhookJob = `-- name: DeleteWebhookJob :exec
+DELETE FROM webhook_jobs
+WHERE id = ?
+`
+
+func (q *Queries) DeleteWebhookJob(ctx context.Context, id int64) error {
+	_, err := q.db.ExecContext(ctx, deleteWebhookJob, id)
+	return err
+}
+
+const getDueWebhookJob = `-- name: GetDueWebhookJob :one
+SELECT id, task_id, url, attempts, next_attempt_at, created_at
+FROM webhook_jobs
+WHERE next_attempt_at <= NOW()
+ORDER BY next_attempt_at
+LIMIT 1
+FOR UPDATE SKIP LOCKED
+`
+
+func (q *Queries) GetDueWebhookJob(ctx context.Context) (WebhookJob, error) {
+	row := q.db.QueryRowContext(ctx, getDueWebhookJob)
+	var i WebhookJob
+	err := row.Scan(
+		&i.ID,
+		&i.TaskID,
+		&i.Url,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const leaseWebhookJob = `-- name: LeaseWebhookJob :exec
+UPDATE webhook_jobs
+SET attempts = attempts + 1, next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+WHERE id = ?
+`
+
+type LeaseWebhookJobParams struct {
+	LeaseSeconds interface{}
+	ID           int64
+}
+
+func (q *Queries) LeaseWebhookJob(ctx context.Context, arg LeaseWebhookJobParams) error {
+	_, err := q.db.ExecContext(ctx, leaseWebhookJob, arg.LeaseSeconds, arg.ID)
+	return err
+}
+
+const rescheduleWebhookJob = `-- name: RescheduleWebhookJob :exec
+UPDATE webhook_jobs
+SET next_attempt_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+WHERE id = ?
+`
+
+type RescheduleWebhookJobParams struct {
+	DelaySeconds interface{}
+	ID           int64
+}
+
+func (q *Queries) RescheduleWebhookJob(ctx context.Context, arg RescheduleWebhookJobParams) error {
+	_, err := q.db.ExecContext(ctx, rescheduleWebhookJob, arg.DelaySeconds, arg.ID)
+	return err
+}
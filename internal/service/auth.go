@@ -0,0 +1,67 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/auth"
+	"github.com/labstack/echo/v4"
+)
+
+type AuthService struct {
+	authenticator *auth.Authenticator
+	wechat        auth.WeChatClient
+}
+
+func NewAuthService(authenticator *auth.Authenticator, wechat auth.WeChatClient) *AuthService {
+	return &AuthService{authenticator: authenticator, wechat: wechat}
+}
+
+type WeChatLoginRequest struct {
+	Code string `json:"code"`
+}
+
+type LoginResponse struct {
+	Token     string    `json:"token"`
+	UserID    string    `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// WeChatLogin 小程序登录，用 wx.login 的 code 换取访问 token
+func (s *AuthService) WeChatLogin() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req WeChatLoginRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		if req.Code == "" {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "code is required"})
+		}
+
+		session, err := s.wechat.Code2Session(c.Request().Context(), req.Code)
+		if err != nil {
+			var wechatErr *auth.WeChatError
+			if errors.As(err, &wechatErr) {
+				return c.JSON(http.StatusUnauthorized, echo.Map{"error": err.Error()})
+			}
+			return err
+		}
+
+		userID := auth.WeChatUserID(session.OpenID)
+		token, expiresAt := s.authenticator.IssueToken(userID)
+		return c.JSON(http.StatusOK, LoginResponse{Token: token, UserID: userID, ExpiresAt: expiresAt})
+	}
+}
+
+// ownedBy 资源是否属于当前调用方
+func ownedBy(c echo.Context, owner sql.NullString) bool {
+	return owner.Valid && owner.String == auth.UserID(c)
+}
+
+// currentUserID 当前调用方的 user_id，用于写入资源的归属
+func currentUserID(c echo.Context) sql.NullString {
+	userID := auth.UserID(c)
+	return sql.NullString{String: userID, Valid: userID != ""}
+}
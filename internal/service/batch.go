@@ -0,0 +1,176 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/ratelimit"
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+)
+
+const defaultBatchMaxItems = 50
+
+type DetectImageBatchItem struct {
+	ImageUrl      string        `json:"image_url"`
+	DetectionType DetectionType `json:"detection_type"`
+	ResponseMode  ResponseMode  `json:"response_mode"`
+}
+
+type DetectImageBatchRequest struct {
+	Items []DetectImageBatchItem `json:"items"`
+}
+
+type DetectImageBatchResponse struct {
+	BatchId string   `json:"batch_id"`
+	TaskIds []string `json:"task_ids"`
+}
+
+// DetectImageBatch 创建一个批次，每张图片对应一个子任务，由任务队列并发执行
+func (s *DetectionService) DetectImageBatch() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		var req DetectImageBatchRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+
+		maxItems := s.cfg.Detection.BatchMaxItems
+		if maxItems <= 0 {
+			maxItems = defaultBatchMaxItems
+		}
+		if len(req.Items) == 0 || len(req.Items) > maxItems {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("items must contain 1 to %d images", maxItems)})
+		}
+		for i, item := range req.Items {
+			if item.ImageUrl == "" {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("items[%d].image_url is required", i)})
+			}
+			if err := s.policy.Check(ctx, item.ImageUrl); err != nil {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("items[%d]: %v", i, err)})
+			}
+			if _, err := LookupDetectionProfile(item.DetectionType); err != nil {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("items[%d]: %v", i, err)})
+			}
+		}
+
+		tx, err := s.conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		qtx := s.db.WithTx(tx)
+		// 配额与批次在同一事务中扣减和创建，创建失败时不占用配额
+		if err := s.limits.ConsumeQuota(c, qtx, len(req.Items)); err != nil {
+			var exceeded *ratelimit.ExceededError
+			if errors.As(err, &exceeded) {
+				return exceeded.Respond(c)
+			}
+			return err
+		}
+		batchId := uuid.New().String()
+		userId := currentUserID(c)
+		if _, err := qtx.CreateBatch(ctx, repository.CreateBatchParams{BatchID: batchId, UserID: userId, Total: int32(len(req.Items))}); err != nil {
+			return err
+		}
+		taskIds := make([]string, 0, len(req.Items))
+		for _, item := range req.Items {
+			taskId := uuid.New().String()
+			if _, err := qtx.CreateTask(ctx, repository.CreateTaskParams{
+				TaskID:        taskId,
+				UserID:        userId,
+				Status:        string(Pending),
+				ImageUrl:      item.ImageUrl,
+				DetectionType: string(item.DetectionType),
+				ResponseMode:  string(item.ResponseMode.orDefault()),
+				BatchID:       sql.NullString{String: batchId, Valid: true},
+			}); err != nil {
+				return err
+			}
+			taskIds = append(taskIds, taskId)
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		s.queue.Notify()
+
+		return c.JSON(http.StatusOK, DetectImageBatchResponse{BatchId: batchId, TaskIds: taskIds})
+	}
+}
+
+type GetBatchRequest struct {
+	BatchId string `query:"batch_id"`
+}
+
+type BatchProgress struct {
+	Total     int `json:"total"`
+	Pending   int `json:"pending"`
+	Running   int `json:"running"`
+	Success   int `json:"success"`
+	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled"`
+	Finished  int `json:"finished"`
+}
+
+type GetBatchResponse struct {
+	BatchId   string            `json:"batch_id"`
+	Done      bool              `json:"done"`
+	Progress  BatchProgress     `json:"progress"`
+	Items     []GetTaskResponse `json:"items"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// GetBatch 查询批次的整体进度和每张图片的识别结果
+func (s *DetectionService) GetBatch() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req GetBatchRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+
+		ctx := c.Request().Context()
+		batch, err := s.db.GetBatch(ctx, req.BatchId)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !ownedBy(c, batch.UserID)) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "batch not found"})
+		}
+		if err != nil {
+			return err
+		}
+		tasks, err := s.db.ListBatchTasks(ctx, sql.NullString{String: req.BatchId, Valid: true})
+		if err != nil {
+			return err
+		}
+
+		response := GetBatchResponse{
+			BatchId:   batch.BatchID,
+			Progress:  BatchProgress{Total: int(batch.Total)},
+			Items:     make([]GetTaskResponse, 0, len(tasks)),
+			CreatedAt: batch.CreatedAt.Time,
+		}
+		for _, task := range tasks {
+			switch TaskStatus(task.Status) {
+			case Pending:
+				response.Progress.Pending++
+			case Running:
+				response.Progress.Running++
+			case Success:
+				response.Progress.Success++
+			case Failed:
+				response.Progress.Failed++
+			case Cancelled:
+				response.Progress.Cancelled++
+			}
+			if TaskStatus(task.Status).Terminal() {
+				response.Progress.Finished++
+			}
+			response.Items = append(response.Items, newGetTaskResponse(task))
+		}
+		response.Done = response.Progress.Finished == response.Progress.Total
+		return c.JSON(http.StatusOK, response)
+	}
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultCacheSize            = 1000
+	defaultCacheTTL             = 24 * time.Hour
+	defaultCacheCleanupInterval = time.Hour
+	// 每次最多删除的过期缓存条数，避免长时间锁表
+	cacheCleanupBatchSize = 1000
+)
+
+// CacheKey 识别结果缓存的键，图片内容、检测类型、提示词和模型任一变化都不会命中旧结果
+type CacheKey struct {
+	ImageHash     string
+	DetectionType DetectionType
+	ResponseMode  ResponseMode
+	PromptVersion string
+	Model         string
+}
+
+func (k CacheKey) String() string {
+	return fmt.Sprintf("%s:%s:%s:%s:%s", k.ImageHash, k.DetectionType, k.ResponseMode, k.PromptVersion, k.Model)
+}
+
+// ResultCache 识别结果缓存，未命中时返回 ok == false
+type ResultCache interface {
+	Get(ctx context.Context, key CacheKey) (content string, ok bool, err error)
+	Set(ctx context.Context, key CacheKey, content string) error
+}
+
+// NewResultCache 根据 [cache] 配置创建结果缓存，backend 为 none 时返回 nil
+func NewResultCache(cfg config.Cache, db *repository.Queries) (ResultCache, error) {
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	switch cfg.Backend {
+	case "none":
+		return nil, nil
+	case "", "memory":
+		size := cfg.Size
+		if size <= 0 {
+			size = defaultCacheSize
+		}
+		return NewLRUCache(size, ttl), nil
+	case "db":
+		interval := cfg.CleanupInterval
+		if interval <= 0 {
+			interval = defaultCacheCleanupInterval
+		}
+		return NewDBCache(db, ttl, interval), nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend: %q", cfg.Backend)
+	}
+}
+
+type lruEntry struct {
+	key       string
+	content   string
+	expiresAt time.Time
+}
+
+// LRUCache 进程内的 LRU 缓存
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	ll      *list.List
+	entries map[string]*list.Element
+}
+
+func NewLRUCache(size int, ttl time.Duration) *LRUCache {
+	return &LRUCache{size: size, ttl: ttl, ll: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (c *LRUCache) Get(ctx context.Context, key CacheKey) (string, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key.String()]
+	if !ok {
+		return "", false, nil
+	}
+	entry := elem.Value.(*lruEntry)
+	if time.Now().After(entry.expiresAt) {
+		c.ll.Remove(elem)
+		delete(c.entries, entry.key)
+		return "", false, nil
+	}
+	c.ll.MoveToFront(elem)
+	return entry.content, true, nil
+}
+
+func (c *LRUCache) Set(ctx context.Context, key CacheKey, content string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	k := key.String()
+	expiresAt := time.Now().Add(c.ttl)
+	if elem, ok := c.entries[k]; ok {
+		entry := elem.Value.(*lruEntry)
+		entry.content, entry.expiresAt = content, expiresAt
+		c.ll.MoveToFront(elem)
+		return nil
+	}
+	c.entries[k] = c.ll.PushFront(&lruEntry{key: k, content: content, expiresAt: expiresAt})
+	for c.ll.Len() > c.size {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
+
+// DBCache 基于 detection_cache 表的缓存，多实例共享
+type DBCache struct {
+	db              *repository.Queries
+	ttl             time.Duration
+	cleanupInterval time.Duration
+}
+
+func NewDBCache(db *repository.Queries, ttl, cleanupInterval time.Duration) *DBCache {
+	return &DBCache{db: db, ttl: ttl, cleanupInterval: cleanupInterval}
+}
+
+func (c *DBCache) Get(ctx context.Context, key CacheKey) (string, bool, error) {
+	entry, err := c.db.GetDetectionCache(ctx, repository.GetDetectionCacheParams{
+		ImageHash:     key.ImageHash,
+		DetectionType: string(key.DetectionType),
+		ResponseMode:  string(key.ResponseMode),
+		PromptVersion: key.PromptVersion,
+		Model:         key.Model,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return string(entry.Result), true, nil
+}
+
+func (c *DBCache) Set(ctx context.Context, key CacheKey, content string) error {
+	return c.db.UpsertDetectionCache(ctx, repository.UpsertDetectionCacheParams{
+		ImageHash:     key.ImageHash,
+		DetectionType: string(key.DetectionType),
+		ResponseMode:  string(key.ResponseMode),
+		PromptVersion: key.PromptVersion,
+		Model:         key.Model,
+		Result:        json.RawMessage(content),
+		TtlSeconds:    int64(c.ttl.Seconds()),
+	})
+}
+
+// Run 定期删除过期的缓存，阻塞直到 ctx 结束
+func (c *DBCache) Run(ctx context.Context, logger echo.Logger) {
+	ticker := time.NewTicker(c.cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := c.DeleteExpired(ctx)
+			if err != nil && ctx.Err() == nil {
+				logger.Errorf("delete expired detection cache failed: %v", err)
+			}
+			if n > 0 {
+				logger.Infof("deleted %d expired detection cache entries", n)
+			}
+		}
+	}
+}
+
+// DeleteExpired 分批删除所有过期的缓存，返回删除的条数
+func (c *DBCache) DeleteExpired(ctx context.Context) (int64, error) {
+	var total int64
+	for {
+		result, err := c.db.DeleteExpiredDetectionCache(ctx, cacheCleanupBatchSize)
+		if err != nil {
+			return total, err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+		if n < cacheCleanupBatchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type CancelTaskRequest struct {
+	TaskId string `json:"task_id" query:"task_id"`
+}
+
+// CancelTask 取消尚未结束的任务。
+// 排队中的任务不会再被领取；执行中的任务会取消模型调用，
+// 在其它实例上执行时由该实例续约失败后取消。
+func (s *DetectionService) CancelTask() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req CancelTaskRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+
+		ctx := c.Request().Context()
+		task, err := s.db.GetTask(ctx, req.TaskId)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !ownedBy(c, task.UserID)) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "task not found"})
+		}
+		if err != nil {
+			return err
+		}
+
+		tx, err := s.conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		qtx := s.db.WithTx(tx)
+		result, err := qtx.CancelTask(ctx, task.TaskID)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			// 任务已经结束，返回最终状态
+			if task, err = s.db.GetTask(ctx, task.TaskID); err != nil {
+				return err
+			}
+			return c.JSON(http.StatusConflict, echo.Map{"error": "task already " + task.Status, "task": newGetTaskResponse(task)})
+		}
+		notify, err := s.webhook.Enqueue(ctx, qtx, task)
+		if err != nil {
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		s.queue.Cancel(task.TaskID)
+		s.events.Publish(task.TaskID, TaskEvent{Status: Cancelled})
+		if notify {
+			s.webhook.Notify()
+		}
+		if task, err = s.db.GetTask(ctx, task.TaskID); err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, newGetTaskResponse(task))
+	}
+}
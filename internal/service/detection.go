@@ -5,17 +5,21 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"math"
 	"net/http"
 	"time"
 
+	"github.com/fanchunke/deeppick-ai/internal/auth"
 	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/fanchunke/deeppick-ai/internal/imageproc"
+	"github.com/fanchunke/deeppick-ai/internal/queue"
+	"github.com/fanchunke/deeppick-ai/internal/ratelimit"
 	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/fanchunke/deeppick-ai/internal/urlpolicy"
 	"github.com/google/uuid"
 	"github.com/invopop/jsonschema"
 	"github.com/labstack/echo/v4"
-	"github.com/openai/openai-go"
-	"github.com/panjf2000/ants/v2"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace"
 )
@@ -23,23 +27,60 @@ import (
 type TaskStatus string
 
 const (
-	Pending TaskStatus = "pending"
-	Running TaskStatus = "running"
-	Success TaskStatus = "success"
-	Failed  TaskStatus = "failed"
+	Pending   TaskStatus = "pending"
+	Running   TaskStatus = "running"
+	Success   TaskStatus = "success"
+	Failed    TaskStatus = "failed"
+	Cancelled TaskStatus = "cancelled"
 )
 
+// Terminal 任务是否已结束
+func (t TaskStatus) Terminal() bool {
+	return t == Success || t == Failed || t == Cancelled
+}
+
+var ErrLeaseLost = errors.New("任务租约已失效")
+
 type DetectionService struct {
-	client *openai.Client
-	cfg    *config.Config
-	tracer trace.Tracer
-	db     *repository.Queries
-	pool   *ants.Pool
-	logger echo.Logger
+	detector VisionDetector
+	cfg      *config.Config
+	tracer   trace.Tracer
+	conn     *sql.DB
+	db       *repository.Queries
+	queue    *queue.Queue
+	retry    *RetryPolicy
+	events   *taskBroker
+	webhook  *WebhookNotifier
+	cache    ResultCache
+	prices   *PriceTable
+	resource *ResourceService
+	limits   *ratelimit.RateLimiter
+	policy   *urlpolicy.Policy
+	client   *http.Client
+	logger   echo.Logger
 }
 
-func NewChatCompletionService(client *openai.Client, cfg *config.Config, db *sql.DB, pool *ants.Pool, logger echo.Logger) *DetectionService {
-	return &DetectionService{client: client, cfg: cfg, tracer: otel.Tracer("DetectionService"), db: repository.New(db), pool: pool}
+func NewDetectionService(detector VisionDetector, cache ResultCache, resource *ResourceService, limits *ratelimit.RateLimiter, cfg *config.Config, db *sql.DB, queue *queue.Queue, logger echo.Logger) *DetectionService {
+	queries := repository.New(db)
+	policy := urlpolicy.New(cfg.URLPolicy)
+	return &DetectionService{
+		detector: detector,
+		cache:    cache,
+		prices:   NewPriceTable(cfg.Pricing),
+		resource: resource,
+		limits:   limits,
+		policy:   policy,
+		client:   policy.Client(30 * time.Second),
+		cfg:      cfg,
+		tracer:   otel.Tracer("DetectionService"),
+		conn:     db,
+		db:       queries,
+		queue:    queue,
+		retry:    NewRetryPolicy(cfg.Retry),
+		events:   newTaskBroker(),
+		webhook:  NewWebhookNotifier(cfg.Webhook, db, logger),
+		logger:   logger,
+	}
 }
 
 type DetectionType string
@@ -49,9 +90,49 @@ const (
 	VegetableDetection DetectionType = "vegetable"
 )
 
+// UnmarshalText 在绑定请求参数时拒绝未注册的检测类型
+func (t *DetectionType) UnmarshalText(text []byte) error {
+	if _, err := LookupDetectionProfile(DetectionType(text)); err != nil {
+		return err
+	}
+	*t = DetectionType(text)
+	return nil
+}
+
+// ResponseMode 识别结果的返回形式
+type ResponseMode string
+
+const (
+	SingleResponse ResponseMode = "single" // 图片中只识别一个物品，返回 DetectImageResponse
+	MultiResponse  ResponseMode = "multi"  // 识别图片中的所有物品，返回 MultiDetectImageResponse
+)
+
+// UnmarshalText 在绑定请求参数时拒绝未知的返回形式
+func (m *ResponseMode) UnmarshalText(text []byte) error {
+	switch mode := ResponseMode(text); mode {
+	case "", SingleResponse, MultiResponse:
+		*m = mode
+		return nil
+	default:
+		return fmt.Errorf("unknown response_mode: %q", mode)
+	}
+}
+
+func (m ResponseMode) orDefault() ResponseMode {
+	if m == "" {
+		return SingleResponse
+	}
+	return m
+}
+
+// DetectImageRequest 图片可以通过 image_url、image_base64 或 multipart 的 image 文件三选一提供
 type DetectImageRequest struct {
-	ImageUrl      string        `json:"image_url"`
-	DetectionType DetectionType `json:"detection_type"`
+	ImageUrl      string        `json:"image_url" form:"image_url"`
+	ImageBase64   string        `json:"image_base64" form:"image_base64"`
+	DetectionType DetectionType `json:"detection_type" form:"detection_type"`
+	ResponseMode  ResponseMode  `json:"response_mode" form:"response_mode"` // 可选，默认 single
+	CallbackUrl   string        `json:"callback_url" form:"callback_url"`   // 可选，任务结束后回调
+	ForceRefresh  bool          `json:"force_refresh" form:"force_refresh"` // 可选，跳过结果缓存重新识别
 }
 
 type DetectImageResponse struct {
@@ -82,6 +163,26 @@ type OverallScore struct {
 	Reason string  `json:"reason" jsonschema_description:"Judgment reason of the overall score"`
 }
 
+type MultiDetectImageResponse struct {
+	Items []DetectedItem `json:"items" jsonschema_description:"All objects detected in the image"`
+}
+
+type DetectedItem struct {
+	Name         string       `json:"name" jsonschema_description:"The object's name"`
+	Category     string       `json:"category" jsonschema_description:"The object's category"`
+	Metrics      []Metric     `json:"metrics" jsonschema_description:"The object's metrics"`
+	OverallScore OverallScore `json:"overall_score" jsonschema_description:"The object's overall_score"`
+	BoundingBox  BoundingBox  `json:"bounding_box" jsonschema_description:"The object's bounding box in the image"`
+}
+
+// BoundingBox 归一化的矩形框，坐标和宽高均为相对图片宽高的比例（0-1），原点在左上角
+type BoundingBox struct {
+	X      float64 `json:"x" jsonschema_description:"Normalized x (0-1) of the box's top-left corner"`
+	Y      float64 `json:"y" jsonschema_description:"Normalized y (0-1) of the box's top-left corner"`
+	Width  float64 `json:"width" jsonschema_description:"Normalized width (0-1) of the box"`
+	Height float64 `json:"height" jsonschema_description:"Normalized height (0-1) of the box"`
+}
+
 func GenerateSchema[T any]() interface{} {
 	reflector := jsonschema.Reflector{
 		AllowAdditionalProperties: false,
@@ -92,7 +193,10 @@ func GenerateSchema[T any]() interface{} {
 	return schema
 }
 
-var DetectImageResponseSchema = GenerateSchema[DetectImageResponse]()
+const (
+	DetectModeAsync = "async"
+	DetectModeSync  = "sync" // 等待任务完成后直接返回识别结果
+)
 
 type DetectionTaskResponse struct {
 	TaskId string `json:"task_id"`
@@ -105,93 +209,331 @@ func (s *DetectionService) DetectImage() echo.HandlerFunc {
 		if err := c.Bind(&req); err != nil {
 			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
 		}
+		if _, err := LookupDetectionProfile(req.DetectionType); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		inline, inlineInfo, err := readInlineImage(c, &req, s.inlineMaxBytes(), uploadLimits(s.cfg.Upload))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		switch {
+		case inline != nil && req.ImageUrl != "":
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "image_url and inline image are mutually exclusive"})
+		case inline == nil && req.ImageUrl == "":
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "image_url, image_base64 or image is required"})
+		case req.ImageUrl != "":
+			if err := s.policy.Check(ctx, req.ImageUrl); err != nil {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+			}
+		}
+		if req.CallbackUrl != "" {
+			if err := s.webhook.Validate(ctx, req.CallbackUrl); err != nil {
+				return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+			}
+		}
+
+		mode := c.QueryParam("mode")
+		if mode != "" && mode != DetectModeAsync && mode != DetectModeSync {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("unknown mode: %q", mode)})
+		}
 
 		taskId := uuid.New().String()
-		if _, err := s.db.CreateTask(ctx, repository.CreateTaskParams{TaskID: taskId, Status: string(Pending)}); err != nil {
-			return err
+		var events <-chan TaskEvent
+		if mode == DetectModeSync {
+			// 先订阅再入库，避免错过任务结束的事件
+			ch, unsubscribe := s.events.Subscribe(taskId)
+			defer unsubscribe()
+			events = ch
 		}
 
-		newCtx := trace.ContextWithSpan(context.Background(), trace.SpanFromContext(ctx))
-		if err := s.pool.Submit(func() {
-			if _, err := s.detectImage(newCtx, &req, taskId); err != nil {
-				log.Printf("exec detection task %s failed: %#v", taskId, err)
-				s.logger.Errorf("exec detection task %s failed: %#v", taskId, err)
-			} else {
-				s.logger.Errorf("exec detection task %s success.", taskId)
+		// 配额与任务在同一事务中扣减和创建，任务创建失败时不占用配额
+		tx, err := s.conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+		qtx := s.db.WithTx(tx)
+		if err := s.limits.ConsumeQuota(c, qtx, 1); err != nil {
+			var exceeded *ratelimit.ExceededError
+			if errors.As(err, &exceeded) {
+				return exceeded.Respond(c)
+			}
+			return err
+		}
+		// 配额扣减成功后才保存直接携带的图片，任务中只记录对象的 key
+		var imageKey sql.NullString
+		if inline != nil {
+			if imageKey.String, err = s.saveInlineImage(ctx, inline, inlineInfo, auth.UserID(c)); err != nil {
+				return err
 			}
+			imageKey.Valid = true
+		}
+		if _, err := qtx.CreateTask(ctx, repository.CreateTaskParams{
+			TaskID:        taskId,
+			UserID:        currentUserID(c),
+			Status:        string(Pending),
+			ImageUrl:      req.ImageUrl,
+			ImageKey:      imageKey,
+			DetectionType: string(req.DetectionType),
+			ResponseMode:  string(req.ResponseMode.orDefault()),
+			ForceRefresh:  req.ForceRefresh,
+			CallbackUrl:   sql.NullString{String: req.CallbackUrl, Valid: req.CallbackUrl != ""},
 		}); err != nil {
 			return err
 		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		s.queue.Notify()
 
+		if mode == DetectModeSync {
+			return s.respondSync(c, taskId, events)
+		}
 		return c.JSON(http.StatusOK, DetectionTaskResponse{TaskId: taskId})
 	}
 }
 
-func (s *DetectionService) detectImage(ctx context.Context, req *DetectImageRequest, taskId string) (*DetectImageResponse, error) {
-	// 更新任务状态
-	if _, err := s.db.UpdateTaskStatus(ctx, repository.UpdateTaskStatusParams{
-		TaskID: taskId,
-		Status: string(Running),
+func (s *DetectionService) inlineMaxBytes() int {
+	if s.cfg.Detection.InlineMaxBytes > 0 {
+		return s.cfg.Detection.InlineMaxBytes
+	}
+	return defaultInlineMaxBytes
+}
+
+// saveInlineImage 将请求中直接携带的图片保存到对象存储，开启持久化时同时记录上传并生成缩略图
+func (s *DetectionService) saveInlineImage(ctx context.Context, data []byte, info *imageproc.Info, uploader string) (string, error) {
+	if s.cfg.Detection.PersistInlineImages {
+		return s.resource.SaveImage(ctx, data, info, uploader)
+	}
+	return s.resource.PutImage(ctx, data, info.Format)
+}
+
+// ProcessTask 处理从队列中领取的检测任务
+func (s *DetectionService) ProcessTask(ctx context.Context, task repository.Task) error {
+	req := &DetectImageRequest{
+		ImageUrl:      task.ImageUrl,
+		DetectionType: DetectionType(task.DetectionType),
+		ResponseMode:  ResponseMode(task.ResponseMode),
+		ForceRefresh:  task.ForceRefresh,
+	}
+	if err := s.detectImage(ctx, req, task); err != nil {
+		return err
+	}
+	s.logger.Infof("exec detection task %s success.", task.TaskID)
+	return nil
+}
+
+func (s *DetectionService) detectImage(ctx context.Context, req *DetectImageRequest, task repository.Task) error {
+	s.events.Publish(task.TaskID, TaskEvent{Status: Running})
+
+	// 进程反复崩溃时租约会被不断回收，超过最大次数后直接失败
+	if int(task.Attempts) > s.retry.MaxAttempts {
+		return s.failTask(ctx, task, &TaskError{Code: ErrCodeTooManyAttempts, Message: "任务执行次数超过上限"})
+	}
+
+	profile, err := LookupDetectionProfile(req.DetectionType)
+	if err != nil {
+		return s.failTask(ctx, task, err)
+	}
+	mode := req.ResponseMode.orDefault()
+
+	// 按图片内容查找缓存，相同图片重复提交时不再调用模型
+	image, err := s.loadImage(ctx, req, task)
+	if err != nil {
+		if ctx.Err() != nil {
+			return err
+		}
+		return s.failTask(ctx, task, err)
+	}
+	imageHash := hashImage(image)
+	if err := s.db.UpdateTaskImageHash(ctx, repository.UpdateTaskImageHashParams{
+		ImageHash: sql.NullString{String: imageHash, Valid: true},
+		TaskID:    task.TaskID,
 	}); err != nil {
-		return nil, err
+		return err
+	}
+	cacheKey := CacheKey{
+		ImageHash:     imageHash,
+		DetectionType: req.DetectionType,
+		ResponseMode:  mode,
+		PromptVersion: profile.Version,
+		Model:         s.detector.Model(),
+	}
+	if s.cache != nil && !req.ForceRefresh {
+		content, ok, err := s.cache.Get(ctx, cacheKey)
+		if err != nil {
+			s.logger.Warnf("get detection cache of task %s failed: %v", task.TaskID, err)
+		}
+		if ok {
+			s.logger.Infof("detection task %s hit cache %s", task.TaskID, cacheKey)
+			return s.completeTask(ctx, task, Success, sql.NullString{String: content, Valid: true}, sql.NullString{})
+		}
+	}
+
+	// 摆正方向、去除 EXIF 并缩小尺寸后以 data URL 发送给模型
+	processed, err := imageproc.Process(image, imageproc.Options{
+		MaxDimension: s.cfg.Image.MaxDimension,
+		JPEGQuality:  s.cfg.Image.JPEGQuality,
+		// image_url 下载的图片没有经过上传校验，解码前同样按上传的尺寸限制检查
+		Limits: uploadLimits(s.cfg.Upload),
+	})
+	if err != nil {
+		return s.failTask(ctx, task, err)
 	}
 
 	// 开始检测
-	schema := openai.ResponseFormatJSONSchemaJSONSchemaParam{
-		Name:        openai.F("ImageDetectResult"),
-		Description: openai.F("image detect result"),
-		Schema:      openai.F(DetectImageResponseSchema),
-		Strict:      openai.Bool(true),
-	}
-	ctx, span := s.tracer.Start(ctx, "chatCompletion")
-	chatCompletion, err := s.client.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-		Messages: openai.F([]openai.ChatCompletionMessageParamUnion{
-			openai.SystemMessage(FruitAndVegetableDetectionPrompt),
-			openai.UserMessage("帮我识别，返回json"),
-			openai.UserMessageParts(openai.ImagePart(req.ImageUrl)),
-		}),
-		Model: openai.F(openai.ChatModel(s.cfg.OpenAI.Model)),
-		ResponseFormat: openai.F(openai.ChatCompletionNewParamsResponseFormatUnion(
-			openai.ResponseFormatJSONSchemaParam{
-				Type:       openai.F(openai.ResponseFormatJSONSchemaTypeJSONSchema),
-				JSONSchema: openai.F(schema),
-			},
-		)),
+	detectCtx, cancel := ctx, context.CancelFunc(func() {})
+	if s.cfg.Detector.Timeout > 0 {
+		detectCtx, cancel = context.WithTimeout(ctx, s.cfg.Detector.Timeout)
+	}
+	detectCtx, span := s.tracer.Start(detectCtx, "chatCompletion")
+	start := time.Now()
+	result, err := s.detector.Detect(detectCtx, &VisionRequest{
+		Profile:  profile,
+		Mode:     mode,
+		ImageUrl: processed.DataURL(),
+		Feedback: repairFeedback(task),
+		OnDelta: func(delta string) {
+			s.events.Publish(task.TaskID, TaskEvent{Delta: delta})
+		},
 	})
+	latency := time.Since(start)
 	span.End()
+	cancel()
 	if err != nil {
-		if _, err := s.db.UpdateTaskStatus(ctx, repository.UpdateTaskStatusParams{
-			TaskID: taskId,
-			Status: string(Failed),
-		}); err != nil {
-			return nil, err
+		// 任务被中断时租约已不再属于当前 worker，不再更新状态
+		if ctx.Err() != nil {
+			return err
 		}
-		return nil, err
+		return s.failTask(ctx, task, err)
 	}
+	// 输出未通过校验的调用同样计费
+	s.recordUsage(ctx, task, result, latency)
 
-	if len(chatCompletion.Choices) == 0 {
-		if _, err := s.db.UpdateTaskStatus(ctx, repository.UpdateTaskStatusParams{
-			TaskID: taskId,
-			Status: string(Failed),
-		}); err != nil {
-			return nil, err
+	// 校验通过后才写入结果，未通过的输出按 invalid_output 进入重试或失败
+	if err := validateDetectionResult(profile, mode, result.Content); err != nil {
+		return s.failTask(ctx, task, err)
+	}
+
+	if s.cache != nil {
+		if err := s.cache.Set(ctx, cacheKey, result.Content); err != nil {
+			s.logger.Warnf("set detection cache of task %s failed: %v", task.TaskID, err)
 		}
-		return nil, errors.New("大模型无返回结果")
 	}
 
-	if err := s.db.UpdateTaskResult(ctx, repository.UpdateTaskResultParams{
-		TaskID: taskId,
-		Status: string(Success),
-		Result: sql.NullString{String: chatCompletion.Choices[0].Message.Content, Valid: true},
-	}); err != nil {
-		return nil, err
+	return s.completeTask(ctx, task, Success, sql.NullString{String: result.Content, Valid: true}, sql.NullString{})
+}
+
+// repairFeedback 上一次执行因输出校验失败而重试时，取出失败原因供模型修正
+func repairFeedback(task repository.Task) []string {
+	if !task.LastError.Valid {
+		return nil
 	}
+	var lastError TaskError
+	if err := json.Unmarshal([]byte(task.LastError.String), &lastError); err != nil || lastError.Code != ErrCodeInvalidOutput {
+		return nil
+	}
+	return lastError.Details
+}
 
-	var response DetectImageResponse
-	if err := json.Unmarshal([]byte(chatCompletion.Choices[0].Message.Content), &response); err != nil {
-		return nil, err
+// loadImage 读取任务的图片，直接携带的图片从对象存储读取，否则按 image_url 下载
+func (s *DetectionService) loadImage(ctx context.Context, req *DetectImageRequest, task repository.Task) ([]byte, error) {
+	if task.ImageKey.Valid {
+		data, err := s.resource.ReadImage(ctx, task.ImageKey.String)
+		if err != nil {
+			return nil, &ImageFetchError{Err: err}
+		}
+		return data, nil
 	}
-	return &response, nil
+	return fetchImage(ctx, s.policy, s.client, req.ImageUrl)
+}
+
+// failTask 记录失败原因，按重试策略重新排队或将任务置为失败
+func (s *DetectionService) failTask(ctx context.Context, task repository.Task, err error) error {
+	taskErr := classifyError(err)
+	taskErr.Retryable = s.retry.ShouldRetry(taskErr, task.Attempts)
+	lastError, marshalErr := json.Marshal(taskErr)
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	if taskErr.Retryable {
+		backoff := s.retry.Backoff(task.Attempts)
+		updated, dbErr := s.db.RetryLeasedTask(ctx, repository.RetryLeasedTaskParams{
+			LastError:    sql.NullString{String: string(lastError), Valid: true},
+			DelaySeconds: int64(math.Ceil(backoff.Seconds())),
+			TaskID:       task.TaskID,
+			LeaseOwner:   task.LeaseOwner,
+		})
+		if err := checkLeased(updated, dbErr); err != nil {
+			return err
+		}
+		s.events.Publish(task.TaskID, TaskEvent{Status: Pending})
+		s.logger.Warnf("detection task %s attempt %d failed, retry after %s: %v", task.TaskID, task.Attempts, backoff, err)
+		return err
+	}
+
+	if err := s.completeTask(ctx, task, Failed, sql.NullString{}, sql.NullString{String: string(lastError), Valid: true}); err != nil {
+		return err
+	}
+	return err
+}
+
+// completeTask 写入任务的最终状态，仅当当前 worker 仍持有租约时生效
+func (s *DetectionService) completeTask(ctx context.Context, task repository.Task, status TaskStatus, result, lastError sql.NullString) error {
+	params := repository.CompleteLeasedTaskParams{
+		Status:     string(status),
+		Result:     result,
+		LastError:  lastError,
+		TaskID:     task.TaskID,
+		LeaseOwner: task.LeaseOwner,
+	}
+	if result.Valid {
+		params.ResultName, params.OverallScore = summarizeResult(ResponseMode(task.ResponseMode), result.String)
+	}
+	// 回调与任务状态在同一事务中写入，提交后即使进程退出也会由其它实例投递
+	tx, err := s.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := s.db.WithTx(tx)
+	updated, err := qtx.CompleteLeasedTask(ctx, params)
+	if err := checkLeased(updated, err); err != nil {
+		return err
+	}
+	notify := false
+	if status.Terminal() {
+		if notify, err = s.webhook.Enqueue(ctx, qtx, task); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	s.events.Publish(task.TaskID, TaskEvent{Status: status})
+	if notify {
+		s.webhook.Notify()
+	}
+	return nil
+}
+
+// RunWebhooks 投递任务结束的回调，阻塞直到 ctx 结束且正在进行的投递退出
+func (s *DetectionService) RunWebhooks(ctx context.Context) {
+	s.webhook.Run(ctx)
+}
+
+// checkLeased 检查按租约更新任务时是否命中，未命中说明租约已被回收
+func checkLeased(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
 }
 
 type GetTaskRequest struct {
@@ -199,12 +541,14 @@ type GetTaskRequest struct {
 }
 
 type GetTaskResponse struct {
-	ID        int32     `json:"id"`
-	TaskID    string    `json:"task_id"`
-	Status    string    `json:"status"`
-	Result    string    `json:"result"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        int32      `json:"id"`
+	TaskID    string     `json:"task_id"`
+	Status    string     `json:"status"`
+	Result    string     `json:"result"`
+	Attempts  int32      `json:"attempts"`
+	LastError *TaskError `json:"last_error"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
 }
 
 func (s *DetectionService) GetTask() echo.HandlerFunc {
@@ -216,18 +560,33 @@ func (s *DetectionService) GetTask() echo.HandlerFunc {
 
 		ctx := c.Request().Context()
 		result, err := s.db.GetTask(ctx, req.TaskId)
+		// 不属于当前用户的任务同样返回不存在，避免泄露任务是否存在
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !ownedBy(c, result.UserID)) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "task not found"})
+		}
 		if err != nil {
 			return err
 		}
 
-		response := GetTaskResponse{
-			ID:        result.ID,
-			TaskID:    result.TaskID,
-			Status:    result.Status,
-			Result:    result.Result.String,
-			CreatedAt: result.CreatedAt.Time,
-			UpdatedAt: result.UpdatedAt.Time,
+		return c.JSON(http.StatusOK, newGetTaskResponse(result))
+	}
+}
+
+func newGetTaskResponse(task repository.Task) GetTaskResponse {
+	response := GetTaskResponse{
+		ID:        task.ID,
+		TaskID:    task.TaskID,
+		Status:    task.Status,
+		Result:    task.Result.String,
+		Attempts:  task.Attempts,
+		CreatedAt: task.CreatedAt.Time,
+		UpdatedAt: task.UpdatedAt.Time,
+	}
+	if task.LastError.Valid {
+		var lastError TaskError
+		if err := json.Unmarshal([]byte(task.LastError.String), &lastError); err == nil {
+			response.LastError = &lastError
 		}
-		return c.JSON(http.StatusOK, response)
 	}
+	return response
 }
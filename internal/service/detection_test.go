@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/labstack/echo/v4"
+)
+
+// taskErrorCode 匹配 last_error 中的错误码
+type taskErrorCode string
+
+func (c taskErrorCode) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	var taskErr TaskError
+	return json.Unmarshal([]byte(s), &taskErr) == nil && taskErr.Code == string(c)
+}
+
+func TestProcessTaskFailsAfterTooManyAttempts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cfg := &config.Config{Retry: config.Retry{MaxAttempts: 3, RetryOn: []string{ErrCodeTooManyAttempts}}}
+	s := NewDetectionService(nil, nil, nil, nil, cfg, db, nil, echo.New().Logger)
+	// 进程反复崩溃后租约被回收并再次领取，attempts 已超过上限
+	task := repository.Task{
+		TaskID:        "task-1",
+		Status:        "running",
+		ImageUrl:      "https://example.com/a.jpg",
+		DetectionType: string(FruitDetection),
+		Attempts:      4,
+		LeaseOwner:    sql.NullString{String: "worker-1", Valid: true},
+	}
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE tasks\nSET status = ?, result = ?")).
+		WithArgs(string(Failed), nil, nil, nil, taskErrorCode(ErrCodeTooManyAttempts), task.TaskID, "worker-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := s.ProcessTask(context.Background(), task); err == nil {
+		t.Fatal("expected error for task exceeding max attempts")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+)
+
+var ErrEmptyCompletion = errors.New("大模型无返回结果")
+
+// VisionRequest 一次视觉模型识别请求
+type VisionRequest struct {
+	Profile  *DetectionProfile
+	Mode     ResponseMode
+	ImageUrl string
+	Feedback []string     // 上一次输出未通过校验的原因，用于让模型修正结果
+	OnDelta  func(string) // 非空时以流式方式调用，逐段回调模型输出
+}
+
+// VisionResult 视觉模型的原始返回
+type VisionResult struct {
+	Content string // 模型返回的 JSON 文本
+	Model   string
+	Usage   Usage
+}
+
+// Usage 一次模型调用消耗的 token
+type Usage struct {
+	PromptTokens     int64
+	CompletionTokens int64
+}
+
+// VisionDetector 视觉模型提供方，屏蔽不同厂商的调用差异
+type VisionDetector interface {
+	Detect(ctx context.Context, req *VisionRequest) (*VisionResult, error)
+	// Model 返回当前使用的模型名称，作为结果缓存键的一部分
+	Model() string
+}
+
+// NewVisionDetector 根据 [detector] 配置创建视觉模型提供方
+func NewVisionDetector(cfg *config.Config) (VisionDetector, error) {
+	switch cfg.Detector.Provider {
+	case "", "openai":
+		return NewOpenAIDetector(cfg.OpenAI), nil
+	case "fake":
+		return NewFakeDetector(), nil
+	default:
+		return nil, fmt.Errorf("unknown detector provider: %q", cfg.Detector.Provider)
+	}
+}
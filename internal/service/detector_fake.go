@@ -0,0 +1,67 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+)
+
+// FakeDetector 不访问网络，按检测类型返回固定结果，用于本地开发和测试
+type FakeDetector struct{}
+
+func NewFakeDetector() *FakeDetector {
+	return &FakeDetector{}
+}
+
+func (d *FakeDetector) Model() string {
+	return "fake"
+}
+
+func (d *FakeDetector) Detect(ctx context.Context, req *VisionRequest) (*VisionResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	p := req.Profile
+	metrics := make([]Metric, 0, len(p.Metrics))
+	for _, m := range p.Metrics {
+		metrics = append(metrics, Metric{Name: m.Name, Label: m.Label, Value: 8, Basis: "fake"})
+	}
+
+	var response interface{}
+	if req.Mode == MultiResponse {
+		response = MultiDetectImageResponse{Items: []DetectedItem{
+			{
+				Name:         "fake " + string(p.Type) + " 1",
+				Category:     p.Category,
+				Metrics:      metrics,
+				OverallScore: OverallScore{Score: 8, Reason: "fake"},
+				BoundingBox:  BoundingBox{X: 0.1, Y: 0.1, Width: 0.3, Height: 0.3},
+			},
+			{
+				Name:         "fake " + string(p.Type) + " 2",
+				Category:     p.Category,
+				Metrics:      metrics,
+				OverallScore: OverallScore{Score: 7, Reason: "fake"},
+				BoundingBox:  BoundingBox{X: 0.5, Y: 0.5, Width: 0.4, Height: 0.4},
+			},
+		}}
+	} else {
+		response = DetectImageResponse{
+			Name:           "fake " + string(p.Type),
+			ScientificName: "fake",
+			Category:       p.Category,
+			Family:         "fake",
+			Metrics:        metrics,
+			OverallScore:   OverallScore{Score: 8, Reason: "fake"},
+			ExpertAdvice:   ExpertAdvice{Storage: "fake", Nutrition: "fake", Selection: "fake"},
+		}
+	}
+	content, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	if req.OnDelta != nil {
+		req.OnDelta(string(content))
+	}
+	return &VisionResult{Content: string(content), Model: "fake"}, nil
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/labstack/echo/v4"
+)
+
+// scriptedDetector 包装 FakeDetector，可以让某次调用返回错误或改写输出，并记录收到的修正提示
+type scriptedDetector struct {
+	*FakeDetector
+	err      error
+	mutate   func(content string) string
+	feedback [][]string
+}
+
+func (d *scriptedDetector) Detect(ctx context.Context, req *VisionRequest) (*VisionResult, error) {
+	d.feedback = append(d.feedback, req.Feedback)
+	if d.err != nil {
+		return nil, d.err
+	}
+	result, err := d.FakeDetector.Detect(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if d.mutate != nil {
+		result.Content = d.mutate(result.Content)
+	}
+	return result, nil
+}
+
+// lastErrorArg 匹配 last_error 的错误码，并保存写入的内容
+type lastErrorArg struct {
+	code  string
+	value *string
+}
+
+func (a lastErrorArg) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	if !ok {
+		return false
+	}
+	var taskErr TaskError
+	if json.Unmarshal([]byte(s), &taskErr) != nil || taskErr.Code != a.code {
+		return false
+	}
+	if a.value != nil {
+		*a.value = s
+	}
+	return true
+}
+
+func newImageServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 64, 64))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 64; y++ {
+			img.Set(x, y, color.RGBA{R: 200, G: uint8(x * 4), B: 50, A: 255})
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(echo.HeaderContentType, "image/png")
+		png.Encode(w, img)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func newFakeDetectionService(t *testing.T, detector VisionDetector) (*DetectionService, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	cfg := &config.Config{
+		Retry: config.Retry{
+			MaxAttempts: 3,
+			RetryOn:     []string{ErrCodeServerError, ErrCodeInvalidOutput},
+		},
+		URLPolicy: config.URLPolicy{AllowPrivate: true},
+	}
+	return NewDetectionService(detector, nil, nil, nil, cfg, db, nil, echo.New().Logger), mock
+}
+
+func newFakeTask(imageUrl string, attempts int32) repository.Task {
+	return repository.Task{
+		TaskID:        "task-1",
+		Status:        string(Running),
+		ImageUrl:      imageUrl,
+		DetectionType: string(FruitDetection),
+		ResponseMode:  string(SingleResponse),
+		Attempts:      attempts,
+		LeaseOwner:    sql.NullString{String: "worker-1", Valid: true},
+	}
+}
+
+func expectImageHash(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("SET image_hash = ?")).WithArgs(sqlmock.AnyArg(), "task-1").WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectUsage(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(regexp.QuoteMeta("SET model = ?")).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectSuccess(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE tasks\nSET status = ?, result = ?")).
+		WithArgs(string(Success), sqlmock.AnyArg(), "fake fruit", 8.0, nil, "task-1", "worker-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func expectRetry(mock sqlmock.Sqlmock, arg lastErrorArg) {
+	mock.ExpectExec(regexp.QuoteMeta("SET status = 'pending', last_error = ?")).
+		WithArgs(arg, sqlmock.AnyArg(), "task-1", "worker-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestFakeDetectorTaskSuccess(t *testing.T) {
+	srv := newImageServer(t)
+	s, mock := newFakeDetectionService(t, NewFakeDetector())
+	expectImageHash(mock)
+	expectUsage(mock)
+	expectSuccess(mock)
+
+	if err := s.ProcessTask(context.Background(), newFakeTask(srv.URL+"/a.png", 1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeDetectorInvalidOutputRepaired(t *testing.T) {
+	srv := newImageServer(t)
+	detector := &scriptedDetector{
+		FakeDetector: NewFakeDetector(),
+		mutate: func(content string) string {
+			var response DetectImageResponse
+			json.Unmarshal([]byte(content), &response)
+			response.OverallScore.Score = 11
+			data, _ := json.Marshal(response)
+			return string(data)
+		},
+	}
+	s, mock := newFakeDetectionService(t, detector)
+
+	// 第一次输出的评分越界，按 invalid_output 重新排队并记录原因
+	var lastError string
+	expectImageHash(mock)
+	expectUsage(mock)
+	expectRetry(mock, lastErrorArg{code: ErrCodeInvalidOutput, value: &lastError})
+	task := newFakeTask(srv.URL+"/a.png", 1)
+	if err := s.ProcessTask(context.Background(), task); err == nil {
+		t.Fatal("expected invalid output error")
+	}
+
+	// 重试时把上次的原因交给模型修正，修正后的输出通过校验
+	detector.mutate = nil
+	expectImageHash(mock)
+	expectUsage(mock)
+	expectSuccess(mock)
+	task.Attempts = 2
+	task.LastError = sql.NullString{String: lastError, Valid: true}
+	if err := s.ProcessTask(context.Background(), task); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(detector.feedback) != 2 || len(detector.feedback[0]) != 0 || len(detector.feedback[1]) == 0 {
+		t.Fatalf("unexpected repair feedback: %q", detector.feedback)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFakeDetectorRetryableError(t *testing.T) {
+	srv := newImageServer(t)
+	detector := &scriptedDetector{
+		FakeDetector: NewFakeDetector(),
+		err:          &ProviderError{StatusCode: http.StatusServiceUnavailable, Err: errors.New("unavailable")},
+	}
+	s, mock := newFakeDetectionService(t, detector)
+
+	// 未达到最大次数时按 server_error 重新排队
+	expectImageHash(mock)
+	expectRetry(mock, lastErrorArg{code: ErrCodeServerError})
+	if err := s.ProcessTask(context.Background(), newFakeTask(srv.URL+"/a.png", 1)); err == nil {
+		t.Fatal("expected provider error")
+	}
+
+	// 最后一次仍然失败时不再重试
+	expectImageHash(mock)
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE tasks\nSET status = ?, result = ?")).
+		WithArgs(string(Failed), nil, nil, nil, lastErrorArg{code: ErrCodeServerError}, "task-1", "worker-1").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	if err := s.ProcessTask(context.Background(), newFakeTask(srv.URL+"/a.png", 3)); err == nil {
+		t.Fatal("expected provider error")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// OpenAIDetector 基于 OpenAI 兼容接口（如 DashScope compatible-mode）的实现
+type OpenAIDetector struct {
+	client *openai.Client
+	model  string
+}
+
+func NewOpenAIDetector(cfg config.OpenAI) *OpenAIDetector {
+	// 重试由任务队列统一负责，关闭 SDK 内置的重试
+	client := openai.NewClient(option.WithBaseURL(cfg.BaseUrl), option.WithAPIKey(cfg.ApiKey), option.WithMaxRetries(0))
+	return &OpenAIDetector{client: client, model: cfg.Model}
+}
+
+func (d *OpenAIDetector) Model() string {
+	return d.model
+}
+
+func (d *OpenAIDetector) Detect(ctx context.Context, req *VisionRequest) (*VisionResult, error) {
+	params := d.newParams(req)
+	if req.OnDelta != nil {
+		return d.detectStreaming(ctx, params, req.OnDelta)
+	}
+
+	chatCompletion, err := d.client.Chat.Completions.New(ctx, params)
+	if err != nil {
+		return nil, wrapOpenAIError(err)
+	}
+	if len(chatCompletion.Choices) == 0 {
+		return nil, ErrEmptyCompletion
+	}
+	return &VisionResult{
+		Content: chatCompletion.Choices[0].Message.Content,
+		Model:   chatCompletion.Model,
+		Usage:   newUsage(chatCompletion.Usage),
+	}, nil
+}
+
+func (d *OpenAIDetector) detectStreaming(ctx context.Context, params openai.ChatCompletionNewParams, onDelta func(string)) (*VisionResult, error) {
+	params.StreamOptions = openai.F(openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.F(true)})
+	stream := d.client.Chat.Completions.NewStreaming(ctx, params)
+	defer stream.Close()
+
+	acc := openai.ChatCompletionAccumulator{}
+	for stream.Next() {
+		chunk := stream.Current()
+		acc.AddChunk(chunk)
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			onDelta(chunk.Choices[0].Delta.Content)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, wrapOpenAIError(err)
+	}
+	if len(acc.Choices) == 0 {
+		return nil, ErrEmptyCompletion
+	}
+	return &VisionResult{
+		Content: acc.Choices[0].Message.Content,
+		Model:   acc.Model,
+		Usage:   newUsage(acc.Usage),
+	}, nil
+}
+
+func (d *OpenAIDetector) newParams(req *VisionRequest) openai.ChatCompletionNewParams {
+	schema := openai.ResponseFormatJSONSchemaJSONSchemaParam{
+		Name:        openai.F("ImageDetectResult"),
+		Description: openai.F("image detect result"),
+		Schema:      openai.F(req.Profile.SchemaFor(req.Mode)),
+		Strict:      openai.Bool(true),
+	}
+	messages := []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage(req.Profile.PromptFor(req.Mode)),
+		openai.UserMessage("帮我识别，返回json"),
+		openai.UserMessageParts(openai.ImagePart(req.ImageUrl)),
+	}
+	if len(req.Feedback) > 0 {
+		messages = append(messages, openai.UserMessage("上一次返回的结果存在以下问题，请修正后重新返回完整的json：\n"+strings.Join(req.Feedback, "\n")))
+	}
+	return openai.ChatCompletionNewParams{
+		Messages: openai.F(messages),
+		Model:    openai.F(openai.ChatModel(d.model)),
+		ResponseFormat: openai.F(openai.ChatCompletionNewParamsResponseFormatUnion(
+			openai.ResponseFormatJSONSchemaParam{
+				Type:       openai.F(openai.ResponseFormatJSONSchemaTypeJSONSchema),
+				JSONSchema: openai.F(schema),
+			},
+		)),
+	}
+}
+
+func newUsage(usage openai.CompletionUsage) Usage {
+	return Usage{PromptTokens: usage.PromptTokens, CompletionTokens: usage.CompletionTokens}
+}
+
+func wrapOpenAIError(err error) error {
+	var apiErr *openai.Error
+	if errors.As(err, &apiErr) {
+		return &ProviderError{StatusCode: apiErr.StatusCode, Err: err}
+	}
+	return err
+}
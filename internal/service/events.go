@@ -0,0 +1,55 @@
+package service
+
+import (
+	"sync"
+)
+
+const taskEventBuffer = 256
+
+// TaskEvent 任务执行过程中推送给订阅者的事件
+type TaskEvent struct {
+	Status TaskStatus // 状态变化事件
+	Delta  string     // 模型流式输出的片段
+}
+
+// taskBroker 进程内的任务事件分发。
+// 状态以数据库为准，事件只用于及时唤醒订阅者，缓冲区满时会丢弃事件。
+type taskBroker struct {
+	mu   sync.Mutex
+	subs map[string]map[chan TaskEvent]struct{}
+}
+
+func newTaskBroker() *taskBroker {
+	return &taskBroker{subs: make(map[string]map[chan TaskEvent]struct{})}
+}
+
+// Subscribe 订阅任务事件，调用返回的函数取消订阅
+func (b *taskBroker) Subscribe(taskId string) (<-chan TaskEvent, func()) {
+	ch := make(chan TaskEvent, taskEventBuffer)
+	b.mu.Lock()
+	if b.subs[taskId] == nil {
+		b.subs[taskId] = make(map[chan TaskEvent]struct{})
+	}
+	b.subs[taskId][ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[taskId], ch)
+		if len(b.subs[taskId]) == 0 {
+			delete(b.subs, taskId)
+		}
+	}
+}
+
+func (b *taskBroker) Publish(taskId string, event TaskEvent) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subs[taskId] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/auth"
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// ListTasksRequest 查询当前用户的识别记录，from/to 支持 RFC3339 或 2006-01-02
+type ListTasksRequest struct {
+	Cursor        string        `query:"cursor"`
+	Limit         int           `query:"limit"`
+	Status        TaskStatus    `query:"status"`
+	DetectionType DetectionType `query:"detection_type"`
+	From          string        `query:"from"`
+	To            string        `query:"to"`
+	Name          string        `query:"name"`
+}
+
+type TaskSummary struct {
+	TaskID        string    `json:"task_id"`
+	Status        string    `json:"status"`
+	DetectionType string    `json:"detection_type"`
+	Name          string    `json:"name"`
+	OverallScore  *float64  `json:"overall_score"`
+	ThumbnailUrl  string    `json:"thumbnail_url,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+type ListTasksResponse struct {
+	Items      []TaskSummary `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"` // 为空表示没有更多记录
+}
+
+// ListTasks 按创建时间倒序分页返回当前用户的识别记录摘要
+func (s *DetectionService) ListTasks() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req ListTasksRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		params, err := newListUserTasksParams(auth.UserID(c), &req)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+
+		ctx := c.Request().Context()
+		// 多查一条用于判断是否还有下一页
+		rows, err := s.db.ListUserTasks(ctx, params)
+		if err != nil {
+			return err
+		}
+		response := ListTasksResponse{Items: make([]TaskSummary, 0, len(rows))}
+		if len(rows) == int(params.Limit) {
+			rows = rows[:len(rows)-1]
+			response.NextCursor = encodeCursor(rows[len(rows)-1].ID)
+		}
+		for _, row := range rows {
+			summary := TaskSummary{
+				TaskID:        row.TaskID,
+				Status:        row.Status,
+				DetectionType: row.DetectionType,
+				Name:          row.ResultName.String,
+				CreatedAt:     row.CreatedAt.Time,
+			}
+			if row.OverallScore.Valid {
+				summary.OverallScore = &row.OverallScore.Float64
+			}
+			if row.ThumbnailKey.Valid {
+				if summary.ThumbnailUrl, err = s.resource.PresignUrl(ctx, row.ThumbnailKey.String); err != nil {
+					return err
+				}
+			}
+			response.Items = append(response.Items, summary)
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+func newListUserTasksParams(userID string, req *ListTasksRequest) (repository.ListUserTasksParams, error) {
+	params := repository.ListUserTasksParams{
+		UserID:        sql.NullString{String: userID, Valid: true},
+		BeforeID:      math.MaxInt32,
+		Status:        sql.NullString{String: string(req.Status), Valid: req.Status != ""},
+		DetectionType: sql.NullString{String: string(req.DetectionType), Valid: req.DetectionType != ""},
+	}
+	switch req.Status {
+	case "", Pending, Running, Success, Failed, Cancelled:
+	default:
+		return params, fmt.Errorf("unknown status: %q", req.Status)
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultListLimit
+	}
+	params.Limit = int32(min(limit, maxListLimit) + 1)
+
+	if req.Cursor != "" {
+		id, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return params, err
+		}
+		params.BeforeID = id
+	}
+
+	var err error
+	if params.CreatedFrom, err = parseDateParam(req.From, false); err != nil {
+		return params, fmt.Errorf("invalid from: %w", err)
+	}
+	if params.CreatedTo, err = parseDateParam(req.To, true); err != nil {
+		return params, fmt.Errorf("invalid to: %w", err)
+	}
+
+	if name := strings.TrimSpace(req.Name); name != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(name)
+		params.NamePattern = sql.NullString{String: "%" + escaped + "%", Valid: true}
+	}
+	return params, nil
+}
+
+// parseDateParam 解析日期参数，只给出日期时作为结束时间包含当天
+func parseDateParam(value string, end bool) (sql.NullTime, error) {
+	if value == "" {
+		return sql.NullTime{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return sql.NullTime{Time: t, Valid: true}, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return sql.NullTime{}, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return sql.NullTime{Time: t, Valid: true}, nil
+}
+
+// 游标是上一页最后一条记录的自增 ID，对调用方不透明
+func encodeCursor(id int32) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(int64(id), 10)))
+}
+
+func decodeCursor(cursor string) (int32, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errInvalidCursor
+	}
+	id, err := strconv.ParseInt(string(raw), 10, 32)
+	if err != nil || id <= 0 {
+		return 0, errInvalidCursor
+	}
+	return int32(id), nil
+}
+
+// summarizeResult 从识别结果中提取列表展示用的名称和综合评分
+func summarizeResult(mode ResponseMode, content string) (sql.NullString, sql.NullFloat64) {
+	if mode.orDefault() == MultiResponse {
+		var result MultiDetectImageResponse
+		if err := json.Unmarshal([]byte(content), &result); err != nil || len(result.Items) == 0 {
+			return sql.NullString{}, sql.NullFloat64{}
+		}
+		names := make([]string, 0, len(result.Items))
+		var total float64
+		for _, item := range result.Items {
+			names = append(names, item.Name)
+			total += item.OverallScore.Score
+		}
+		return truncatedName(strings.Join(names, "、")), sql.NullFloat64{Float64: total / float64(len(result.Items)), Valid: true}
+	}
+
+	var result DetectImageResponse
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return sql.NullString{}, sql.NullFloat64{}
+	}
+	return truncatedName(result.Name), sql.NullFloat64{Float64: result.OverallScore.Score, Valid: true}
+}
+
+// truncatedName 截断到 result_name 列的长度（255 个字符）
+func truncatedName(name string) sql.NullString {
+	if r := []rune(name); len(r) > 255 {
+		name = string(r[:255])
+	}
+	return sql.NullString{String: name, Valid: name != ""}
+}
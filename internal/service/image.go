@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/fanchunke/deeppick-ai/internal/urlpolicy"
+)
+
+// ImageFetchError 下载待识别图片失败
+type ImageFetchError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *ImageFetchError) Error() string {
+	if e.StatusCode != 0 {
+		return fmt.Sprintf("fetch image status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("fetch image: %v", e.Err)
+}
+
+func (e *ImageFetchError) Unwrap() error {
+	return e.Err
+}
+
+// fetchImage 按地址策略下载待识别的图片
+func fetchImage(ctx context.Context, policy *urlpolicy.Policy, client *http.Client, imageUrl string) ([]byte, error) {
+	if err := policy.Check(ctx, imageUrl); err != nil {
+		return nil, &ImageFetchError{Err: err}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageUrl, nil)
+	if err != nil {
+		return nil, &ImageFetchError{Err: err}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, &ImageFetchError{Err: err}
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &ImageFetchError{StatusCode: resp.StatusCode}
+	}
+	if err := policy.CheckResponse(resp); err != nil {
+		return nil, &ImageFetchError{Err: err}
+	}
+
+	maxBytes := policy.MaxContentLength()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, &ImageFetchError{Err: err}
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, &ImageFetchError{Err: fmt.Errorf("image larger than %d bytes", maxBytes)}
+	}
+	return data, nil
+}
+
+func hashImage(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fanchunke/deeppick-ai/internal/imageproc"
+	"github.com/labstack/echo/v4"
+)
+
+const defaultInlineMaxBytes = 10 << 20
+
+// readInlineImage 读取请求中直接携带的图片，支持 multipart 的 image 文件和 image_base64 字段。
+// 请求没有携带图片时返回 nil。
+func readInlineImage(c echo.Context, req *DetectImageRequest, maxBytes int, limits imageproc.Limits) ([]byte, *imageproc.Info, error) {
+	var data []byte
+	if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), echo.MIMEMultipartForm) {
+		if file, err := c.FormFile("image"); err == nil {
+			if file.Size > int64(maxBytes) {
+				return nil, nil, fmt.Errorf("image larger than %d bytes", maxBytes)
+			}
+			f, err := file.Open()
+			if err != nil {
+				return nil, nil, err
+			}
+			defer f.Close()
+			if data, err = io.ReadAll(io.LimitReader(f, int64(maxBytes)+1)); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	if req.ImageBase64 != "" {
+		if data != nil {
+			return nil, nil, errors.New("image and image_base64 are mutually exclusive")
+		}
+		encoded := req.ImageBase64
+		// 兼容客户端直接传 data URL
+		if strings.HasPrefix(encoded, "data:") {
+			if _, after, ok := strings.Cut(encoded, ";base64,"); ok {
+				encoded = after
+			}
+		}
+		if base64.StdEncoding.DecodedLen(len(encoded)) > maxBytes+2 {
+			return nil, nil, fmt.Errorf("image larger than %d bytes", maxBytes)
+		}
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(encoded); err != nil {
+			return nil, nil, fmt.Errorf("invalid image_base64: %w", err)
+		}
+	}
+
+	if data == nil {
+		return nil, nil, nil
+	}
+	if len(data) == 0 {
+		return nil, nil, errors.New("image is empty")
+	}
+	if len(data) > maxBytes {
+		return nil, nil, fmt.Errorf("image larger than %d bytes", maxBytes)
+	}
+	info, err := imageproc.Validate(data, limits)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, info, nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/invopop/jsonschema"
+)
+
+// MetricSpec 描述检测结果中的一项评分指标
+type MetricSpec struct {
+	Name  string // 指标英文名
+	Label string // 指标中文名
+	Basis string // 提示模型的判断依据
+}
+
+// DetectionProfile 描述一种检测类型使用的提示词、指标集合和返回结构
+type DetectionProfile struct {
+	Type        DetectionType
+	Category    string // 返回结果中 category 字段的取值
+	Prompt      string
+	Metrics     []MetricSpec
+	Schema      interface{}
+	MultiPrompt string      // 多物品识别使用的提示词
+	MultiSchema interface{} // 多物品识别使用的返回结构
+	Version     string      // 由提示词和返回结构计算，任一变化都会使结果缓存失效
+}
+
+var (
+	profilesMu        sync.RWMutex
+	detectionProfiles = map[DetectionType]*DetectionProfile{}
+)
+
+// NewDetectionProfile 根据检测对象和指标集合生成提示词与返回结构
+func NewDetectionProfile(t DetectionType, subject, category string, metrics []MetricSpec) *DetectionProfile {
+	p := &DetectionProfile{
+		Type:        t,
+		Category:    category,
+		Prompt:      buildDetectionPrompt(detectionPromptTemplate, subject, category, metrics),
+		Metrics:     metrics,
+		Schema:      newDetectionSchema(category, metrics),
+		MultiPrompt: buildDetectionPrompt(multiDetectionPromptTemplate, subject, category, metrics),
+		MultiSchema: newMultiDetectionSchema(category, metrics),
+	}
+	p.Version = p.computeVersion()
+	return p
+}
+
+func (p *DetectionProfile) computeVersion() string {
+	h := sha256.New()
+	h.Write([]byte(p.Prompt))
+	h.Write([]byte(p.MultiPrompt))
+	json.NewEncoder(h).Encode([]interface{}{p.Schema, p.MultiSchema})
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// PromptFor 返回指定返回形式使用的提示词
+func (p *DetectionProfile) PromptFor(mode ResponseMode) string {
+	if mode == MultiResponse {
+		return p.MultiPrompt
+	}
+	return p.Prompt
+}
+
+// SchemaFor 返回指定返回形式使用的返回结构
+func (p *DetectionProfile) SchemaFor(mode ResponseMode) interface{} {
+	if mode == MultiResponse {
+		return p.MultiSchema
+	}
+	return p.Schema
+}
+
+// RegisterDetectionProfile 注册检测类型，重复注册会覆盖已有配置
+func RegisterDetectionProfile(p *DetectionProfile) {
+	if p.Version == "" {
+		p.Version = p.computeVersion()
+	}
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	detectionProfiles[p.Type] = p
+}
+
+// LookupDetectionProfile 查找检测类型对应的配置
+func LookupDetectionProfile(t DetectionType) (*DetectionProfile, error) {
+	profilesMu.RLock()
+	defer profilesMu.RUnlock()
+	p, ok := detectionProfiles[t]
+	if !ok {
+		return nil, fmt.Errorf("unknown detection_type: %q", t)
+	}
+	return p, nil
+}
+
+// newDetectionSchema 在 DetectImageResponse 的基础上限定 category 和指标名称
+func newDetectionSchema(category string, metrics []MetricSpec) interface{} {
+	schema := GenerateSchema[DetectImageResponse]().(*jsonschema.Schema)
+	restrictDetectionSchema(schema, category, metrics)
+	return schema
+}
+
+// newMultiDetectionSchema 在 MultiDetectImageResponse 的基础上限定每一项的 category 和指标名称
+func newMultiDetectionSchema(category string, metrics []MetricSpec) interface{} {
+	schema := GenerateSchema[MultiDetectImageResponse]().(*jsonschema.Schema)
+	if p, ok := schema.Properties.Get("items"); ok && p.Items != nil {
+		restrictDetectionSchema(p.Items, category, metrics)
+	}
+	return schema
+}
+
+func restrictDetectionSchema(schema *jsonschema.Schema, category string, metrics []MetricSpec) {
+	if p, ok := schema.Properties.Get("category"); ok {
+		p.Enum = []any{category}
+	}
+	if p, ok := schema.Properties.Get("metrics"); ok && p.Items != nil {
+		if name, ok := p.Items.Properties.Get("name"); ok {
+			names := make([]any, 0, len(metrics))
+			for _, m := range metrics {
+				names = append(names, m.Name)
+			}
+			name.Enum = names
+		}
+	}
+}
+
+func init() {
+	RegisterDetectionProfile(NewDetectionProfile(FruitDetection, "水果", "水果", []MetricSpec{
+		{Name: "ripeness", Label: "成熟度", Basis: "该物品成熟度的判断依据，例如颜色、纹理、果肉状况等"},
+		{Name: "freshness", Label: "新鲜度", Basis: "该物品新鲜度的判断依据，例如果蒂状态、水分损失、表皮状况等"},
+		{Name: "moisture", Label: "水分含量", Basis: "该物品水分含量的判断依据，例如表皮光泽度、重量、是否干瘪等"},
+		{Name: "sweetness", Label: "甜度", Basis: "该物品甜度的判断依据，例如颜色、表皮糖斑、香气等"},
+	}))
+	RegisterDetectionProfile(NewDetectionProfile(VegetableDetection, "蔬菜", "蔬菜", []MetricSpec{
+		{Name: "freshness", Label: "新鲜度", Basis: "该物品新鲜度的判断依据，例如叶子状态、水分损失、表皮状况等"},
+		{Name: "moisture", Label: "水分含量", Basis: "该物品水分含量的判断依据，例如表皮光泽度、茎叶挺立程度、是否萎蔫等"},
+		{Name: "tenderness", Label: "脆嫩度", Basis: "该物品脆嫩度的判断依据，例如茎秆粗细、纤维化程度、断面状态等"},
+		{Name: "appearance", Label: "外观完整度", Basis: "该物品外观的判断依据，例如是否有虫眼、斑点、机械损伤、腐烂等"},
+	}))
+}
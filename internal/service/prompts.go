@@ -1,39 +1,21 @@
 package service
 
-var FruitAndVegetableDetectionPrompt = `
-你是一个专业的农产品识别专家。你的任务是从图片中识别水果或蔬菜，并返回严格的 JSON 结果。请按照以下格式返回结果，不允许输出除 JSON 以外的任何内容：
+import (
+	"fmt"
+	"strings"
+)
+
+var detectionPromptTemplate = `
+你是一个专业的农产品识别专家。你的任务是从图片中识别%[1]s，并返回严格的 JSON 结果。请按照以下格式返回结果，不允许输出除 JSON 以外的任何内容：
 
 {
   "name": "<物品的常见名称>",
   "scientific_name": "<物品的学名>",
-  "category": "<水果/蔬菜>",
+  "category": "%[2]s",
   "family": "<该物品所属的科目>",
 
   "metrics": [
-    {
-        "name": <成熟度指标英文名>,
-        "label": <中文指标名>,
-        "value": <1-10 的评分>,
-        "basis": "<该物品成熟度的判断依据，例如颜色、纹理、果肉状况等>"
-    },
-    {
-        "name": <新鲜度指标英文名>,
-        "label": <中文指标名>,
-        "value": <1-10 的评分>,
-        "basis": "<该物品新鲜度的判断依据，例如叶子状态、水分损失、表皮状况等>"
-    },
-    {
-        "name": <水分含量指标英文名>,
-        "label": <中文指标名>,
-        "value": <1-10 的评分>,
-        "basis": "<该物品水分含量的判断依据，例如表皮光泽度、重量、是否干瘪等>"
-    },
-    {
-        "name": <甜度指标英文名>,
-        "label": <中文指标名>,
-        "value": <1-10 的评分>,
-        "basis": "<该物品甜度的判断依据，例如颜色、表皮糖斑、香气等>"
-    },
+%[3]s
   ],
 
   "overall_score": {
@@ -48,5 +30,53 @@ var FruitAndVegetableDetectionPrompt = `
   }
 }
 
+metrics 必须且只能包含以上 %[4]d 项指标，name 和 label 必须与上面给出的完全一致。
 请确保 JSON 结构稳定，严格按照格式返回，不要包含任何 JSON 以外的文本、解释或额外信息。
 `
+
+var multiDetectionPromptTemplate = `
+你是一个专业的农产品识别专家。你的任务是找出图片中的所有%[1]s，逐个给出评分和位置，并返回严格的 JSON 结果。请按照以下格式返回结果，不允许输出除 JSON 以外的任何内容：
+
+{
+  "items": [
+    {
+      "name": "<物品的常见名称>",
+      "category": "%[2]s",
+      "metrics": [
+%[3]s
+      ],
+      "overall_score": {
+        "score": <1-10 的综合评分>,
+        "reason": "<综合评分的计算依据>"
+      },
+      "bounding_box": {
+        "x": <物品外接矩形左上角的横坐标，相对图片宽度的比例，0-1>,
+        "y": <物品外接矩形左上角的纵坐标，相对图片高度的比例，0-1>,
+        "width": <外接矩形的宽度，相对图片宽度的比例，0-1>,
+        "height": <外接矩形的高度，相对图片高度的比例，0-1>
+      }
+    }
+  ]
+}
+
+图片中有多个不同种类的%[1]s时，每种分别返回一项，同一种类的多个个体合并为一项，bounding_box 覆盖该种类的所有个体。
+图片中没有%[1]s时返回空的 items。
+每一项的 metrics 必须且只能包含以上 %[4]d 项指标，name 和 label 必须与上面给出的完全一致。
+请确保 JSON 结构稳定，严格按照格式返回，不要包含任何 JSON 以外的文本、解释或额外信息。
+`
+
+var detectionMetricTemplate = `    {
+        "name": "%s",
+        "label": "%s",
+        "value": <1-10 的评分>,
+        "basis": "<%s>"
+    }`
+
+// buildDetectionPrompt 根据检测对象和指标集合生成系统提示词
+func buildDetectionPrompt(template, subject, category string, metrics []MetricSpec) string {
+	items := make([]string, 0, len(metrics))
+	for _, m := range metrics {
+		items = append(items, fmt.Sprintf(detectionMetricTemplate, m.Name, m.Label, m.Basis))
+	}
+	return fmt.Sprintf(template, subject, category, strings.Join(items, ",\n"), len(metrics))
+}
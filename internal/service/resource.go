@@ -1,142 +1,539 @@
 package service
 
 import (
+	"bytes"
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
-	"net/url"
-	"path"
+	"os"
+	"regexp"
 	"time"
 
+	"github.com/fanchunke/deeppick-ai/internal/auth"
 	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/fanchunke/deeppick-ai/internal/imageproc"
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/fanchunke/deeppick-ai/internal/storage"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
-	"github.com/tencentyun/cos-go-sdk-v5"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace"
 )
 
-type CosClient struct {
-	*cos.Client
-	tmpSecretId  string
-	tmpSecretKey string
-	token        string
-	expiredTime  int64
-}
+const (
+	defaultUploadMaxBytes     = 10 << 20
+	defaultUploadMinDimension = 32
+	defaultUploadMaxDimension = 10000
+	defaultUploadMaxPixels    = 50_000_000
+	// multipart 请求中除文件以外的部分预留的大小
+	multipartOverhead    = 1 << 20
+	defaultTicketExpires = 15 * time.Minute
+	defaultThumbnailSize = 256
+	defaultDisplaySize   = 1024
+	// 直传的对象都放在该前缀下
+	ticketKeyPrefix = "uploads/"
+)
+
+var errFileTooLarge = errors.New("file too large")
+
+var ticketKeyPattern = regexp.MustCompile(`^uploads/[0-9a-f-]{36}\.(jpg|png|webp)$`)
 
 type ResourceService struct {
-	cosClient *CosClient
-	tracer    trace.Tracer
-	cfg       *config.Config
+	store  storage.ObjectStore
+	db     *repository.Queries
+	tracer trace.Tracer
+	cfg    *config.Config
 }
 
-func NewResourceService(cfg *config.Config) *ResourceService {
-	return &ResourceService{cosClient: nil, cfg: cfg, tracer: otel.Tracer("UploadService")}
+func NewResourceService(cfg *config.Config, store storage.ObjectStore, db *sql.DB) *ResourceService {
+	return &ResourceService{store: store, db: repository.New(db), cfg: cfg, tracer: otel.Tracer("UploadService")}
 }
 
 type UploadResponse struct {
-	Url string `json:"url"`
+	Url          string `json:"url"`
+	ThumbnailUrl string `json:"thumbnail_url,omitempty"`
+	DisplayUrl   string `json:"display_url,omitempty"`
 }
 
 func (s *ResourceService) Upload() echo.HandlerFunc {
 	return func(c echo.Context) error {
-		file, err := c.FormFile("image")
+		maxBytes := uploadMaxBytes(s.cfg.Upload)
+		c.Request().Body = http.MaxBytesReader(c.Response(), c.Request().Body, maxBytes+multipartOverhead)
+		file, hash, err := receiveFile(c.Request(), "image", maxBytes)
 		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.Is(err, errFileTooLarge) || errors.As(err, &maxBytesErr) {
+				return c.JSON(http.StatusRequestEntityTooLarge, echo.Map{"error": fmt.Sprintf("image larger than %d bytes", maxBytes)})
+			}
 			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
 		}
-		f, err := file.Open()
+		defer os.Remove(file.Name())
+		defer file.Close()
+
+		// 相同内容的图片已经上传过时直接复用，不再读取和解码
+		ctx := c.Request().Context()
+		response, err := s.reuseUpload(ctx, hash, auth.UserID(c))
+		if err != nil {
+			return err
+		}
+		if response != nil {
+			return c.JSON(http.StatusOK, response)
+		}
+
+		data, err := os.ReadFile(file.Name())
+		if err != nil {
+			return err
+		}
+		// 不信任客户端的文件名和 Content-Type，按文件内容识别格式并确认可以解码
+		info, err := imageproc.Validate(data, uploadLimits(s.cfg.Upload))
 		if err != nil {
 			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
 		}
-		defer f.Close()
 
+		response, err = s.saveImage(ctx, data, hash, info, auth.UserID(c))
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(http.StatusOK, response)
+
+	}
+}
+
+// receiveFile 把 multipart 请求中的文件边接收边写入临时文件，同时计算内容的 SHA-256，
+// 不把整个文件读入内存。调用方负责关闭并删除返回的文件。
+func receiveFile(r *http.Request, field string, maxBytes int64) (*os.File, string, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, "", err
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil, "", http.ErrMissingFile
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if part.FormName() != field || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		defer part.Close()
+
+		file, err := os.CreateTemp("", "upload-*")
+		if err != nil {
+			return nil, "", err
+		}
+		hasher := sha256.New()
+		n, err := io.Copy(file, io.TeeReader(io.LimitReader(part, maxBytes+1), hasher))
+		if err == nil && n > maxBytes {
+			err = errFileTooLarge
+		}
+		if err != nil {
+			file.Close()
+			os.Remove(file.Name())
+			return nil, "", err
+		}
+		return file, hex.EncodeToString(hasher.Sum(nil)), nil
+	}
+}
+
+type UploadTicketRequest struct {
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+type UploadTicketResponse struct {
+	Key       string                    `json:"key"`
+	Upload    *storage.PresignedRequest `json:"upload"`
+	ExpiresAt time.Time                 `json:"expires_at"`
+}
+
+// UploadTicket 签发直传对象存储的凭证，客户端按返回的请求上传后调用 UploadComplete
+func (s *ResourceService) UploadTicket() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req UploadTicketRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		format, err := imageproc.ParseContentType(req.ContentType)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		maxBytes := uploadMaxBytes(s.cfg.Upload)
+		if req.Size <= 0 || req.Size > maxBytes {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("size must be between 1 and %d bytes", maxBytes)})
+		}
+
+		expires := s.cfg.Upload.TicketExpires
+		if expires <= 0 {
+			expires = defaultTicketExpires
+		}
 		ctx := c.Request().Context()
-		if s.cosClient == nil || s.cosClient.expiredTime-time.Now().Unix() < 0 {
-			cosAuthCtx, cosAuthSpan := s.tracer.Start(ctx, "cosAuth")
-			if err := s.initCosClient(cosAuthCtx); err != nil {
+		key := fmt.Sprintf("%s%s%s", ticketKeyPrefix, uuid.New().String(), format.Ext())
+		// 记录申请凭证的用户，只有该用户可以确认上传
+		if err := s.db.CreateUploadTicket(ctx, repository.CreateUploadTicketParams{
+			ObjectKey:   key,
+			Uploader:    auth.UserID(c),
+			ContentType: format.ContentType(),
+			Size:        req.Size,
+		}); err != nil {
+			return err
+		}
+		upload, err := s.store.PresignPut(ctx, key, expires, storage.PutOptions{
+			ContentType: format.ContentType(),
+			Size:        req.Size,
+		})
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, UploadTicketResponse{Key: key, Upload: upload, ExpiresAt: time.Now().Add(expires)})
+	}
+}
+
+type UploadCompleteRequest struct {
+	Key string `json:"key"`
+}
+
+// UploadComplete 确认直传的对象与凭证一致，读取内容按上传的规则校验后记录上传，返回下载链接。
+// 未通过校验的对象会被删除。
+func (s *ResourceService) UploadComplete() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req UploadCompleteRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		if !ticketKeyPattern.MatchString(req.Key) {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("invalid key: %q", req.Key)})
+		}
+
+		ctx := c.Request().Context()
+		// 不属于当前用户的凭证同样返回不存在
+		ticket, err := s.db.GetUploadTicket(ctx, req.Key)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && ticket.Uploader != auth.UserID(c)) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "upload ticket not found"})
+		}
+		if err != nil {
+			return err
+		}
+		if ticket.CompletedAt.Valid {
+			return c.JSON(http.StatusConflict, echo.Map{"error": "upload already completed"})
+		}
+
+		data, info, err := s.readTicketObject(ctx, ticket)
+		if errors.Is(err, storage.ErrNotFound) {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "object not uploaded"})
+		}
+		if err != nil {
+			var rejected *rejectedUploadError
+			if !errors.As(err, &rejected) {
 				return err
 			}
-			cosAuthSpan.End()
+			// 对象不是通过凭证上传的或内容不是合法的图片，删除后拒绝
+			if err := s.store.Delete(ctx, req.Key); err != nil {
+				c.Logger().Warnf("delete rejected upload %s failed: %v", req.Key, err)
+			}
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
 		}
 
-		// 开始上传
-		uploadCtx, span := s.tracer.Start(ctx, "upload")
-		objectName := fmt.Sprintf("%s%s", uuid.New().String(), path.Ext(file.Filename))
-		_, err = s.cosClient.Object.Put(uploadCtx, objectName, f, nil)
+		// 并发确认同一个凭证时只有一个请求生效
+		result, err := s.db.CompleteUploadTicket(ctx, req.Key)
 		if err != nil {
 			return err
 		}
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return c.JSON(http.StatusConflict, echo.Map{"error": "upload already completed"})
+		}
 
-		span.End()
-
-		// 获取链接
-		getPreSignedUrlCtx, span := s.tracer.Start(ctx, "getPresignedURL")
-		opt := &cos.PresignedURLOptions{
-			Query:  &url.Values{},
-			Header: &http.Header{},
+		hash := hashImage(data)
+		thumbnailKey, displayKey, err := s.saveVariants(ctx, data, hash)
+		if err != nil {
+			return err
 		}
-		opt.Query.Add("x-cos-security-token", s.cosClient.token)
-		presignedURL, err := s.cosClient.Object.GetPresignedURL(getPreSignedUrlCtx, http.MethodGet, objectName, s.cosClient.tmpSecretId, s.cosClient.tmpSecretKey, time.Hour, opt)
+		response, err := s.recordUpload(ctx, repository.CreateUploadParams{
+			ImageHash:    hash,
+			ObjectKey:    req.Key,
+			ContentType:  info.Format.ContentType(),
+			Size:         int64(len(data)),
+			Width:        int32(info.Width),
+			Height:       int32(info.Height),
+			ThumbnailKey: thumbnailKey,
+			DisplayKey:   displayKey,
+			Uploader:     sql.NullString{String: ticket.Uploader, Valid: true},
+		})
 		if err != nil {
 			return err
 		}
-		span.End()
+		return c.JSON(http.StatusOK, response)
+	}
+}
 
-		return c.JSON(http.StatusOK, UploadResponse{
-			Url: presignedURL.String(),
-		})
+// rejectedUploadError 直传的对象与凭证不一致或不是合法的图片
+type rejectedUploadError struct {
+	reason string
+}
+
+func (e *rejectedUploadError) Error() string {
+	return "uploaded object rejected: " + e.reason
+}
+
+// readTicketObject 读取直传的对象，检查与凭证签名的类型和大小一致并校验图片内容
+func (s *ResourceService) readTicketObject(ctx context.Context, ticket repository.UploadTicket) ([]byte, *imageproc.Info, error) {
+	stat, err := s.store.Stat(ctx, ticket.ObjectKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if stat.Size != ticket.Size || stat.ContentType != ticket.ContentType {
+		return nil, nil, &rejectedUploadError{reason: "object does not match the ticket"}
+	}
+
+	r, err := s.store.Get(ctx, ticket.ObjectKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Close()
+	data, err := io.ReadAll(io.LimitReader(r, ticket.Size+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(data)) != ticket.Size {
+		return nil, nil, &rejectedUploadError{reason: "object does not match the ticket"}
+	}
+
+	// 与 Upload 相同，不信任 Content-Type，按文件内容识别格式并确认可以解码
+	info, err := imageproc.Validate(data, uploadLimits(s.cfg.Upload))
+	if err != nil {
+		return nil, nil, &rejectedUploadError{reason: err.Error()}
+	}
+	if info.Format.ContentType() != ticket.ContentType {
+		return nil, nil, &rejectedUploadError{reason: fmt.Sprintf("content is %s, expect %s", info.Format.ContentType(), ticket.ContentType)}
+	}
+	return data, info, nil
+}
 
+// SaveImage 保存请求中直接携带的图片并记录上传，返回原图的 key
+func (s *ResourceService) SaveImage(ctx context.Context, data []byte, info *imageproc.Info, uploader string) (string, error) {
+	hash := hashImage(data)
+	if _, err := s.saveImage(ctx, data, hash, info, uploader); err != nil {
+		return "", err
 	}
+	return imageKey(hash, info.Format), nil
 }
 
-type CosAuthResponse struct {
-	TmpSecretId  string `json:"TmpSecretId"`
-	TmpSecretKey string `json:"TmpSecretKey"`
-	Token        string `json:"Token"`
-	ExpiredTime  int64  `json:"ExpiredTime"`
+// PutImage 只保存原图，不生成缩略图和展示图也不记录上传，返回原图的 key
+func (s *ResourceService) PutImage(ctx context.Context, data []byte, format imageproc.Format) (string, error) {
+	key := imageKey(hashImage(data), format)
+	if _, err := s.putIfAbsent(ctx, key, data, format); err != nil {
+		return "", err
+	}
+	return key, nil
 }
 
-func (s *ResourceService) getCosAuth(ctx context.Context) (*CosAuthResponse, error) {
-	url := "http://api.weixin.qq.com/_/cos/getauth"
-	resp, err := http.Get(url)
+// ReadImage 读取对象存储中的图片
+func (s *ResourceService) ReadImage(ctx context.Context, key string) ([]byte, error) {
+	r, err := s.store.Get(ctx, key)
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("cos auth response status code: %d", resp.StatusCode)
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// PresignUrl 返回对象的临时下载链接
+func (s *ResourceService) PresignUrl(ctx context.Context, key string) (string, error) {
+	return s.store.PresignGet(ctx, key, storage.PresignExpires(s.cfg.Storage))
+}
+
+// saveImage 按内容哈希保存原图、缩略图和展示图并记录上传，相同内容的图片只存储一份
+func (s *ResourceService) saveImage(ctx context.Context, data []byte, hash string, info *imageproc.Info, uploader string) (*UploadResponse, error) {
+	objectName := imageKey(hash, info.Format)
+	existed, err := s.putIfAbsent(ctx, objectName, data, info.Format)
+	if err != nil {
+		return nil, err
 	}
 
-	defer resp.Body.Close()
+	// 原图已存在时沿用之前生成的缩略图和展示图
+	var thumbnailKey, displayKey sql.NullString
+	reused := false
+	if existed {
+		prev, err := s.db.GetUploadByHash(ctx, hash)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if err == nil {
+			thumbnailKey, displayKey, reused = prev.ThumbnailKey, prev.DisplayKey, true
+		}
+	}
+	if !reused {
+		if thumbnailKey, displayKey, err = s.saveVariants(ctx, data, hash); err != nil {
+			return nil, err
+		}
+	}
 
-	var response CosAuthResponse
-	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+	return s.recordUpload(ctx, repository.CreateUploadParams{
+		ImageHash:    hash,
+		ObjectKey:    objectName,
+		ContentType:  info.Format.ContentType(),
+		Size:         int64(len(data)),
+		Width:        int32(info.Width),
+		Height:       int32(info.Height),
+		ThumbnailKey: thumbnailKey,
+		DisplayKey:   displayKey,
+		Uploader:     sql.NullString{String: uploader, Valid: uploader != ""},
+	})
+}
+
+// reuseUpload 相同内容的图片已经上传过且原图仍然存在时，沿用之前的对象记录本次上传。
+// 没有可以复用的上传时返回 nil。
+func (s *ResourceService) reuseUpload(ctx context.Context, hash, uploader string) (*UploadResponse, error) {
+	prev, err := s.db.GetUploadByHash(ctx, hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
 		return nil, err
 	}
-	return &response, nil
+	if _, err := s.store.Stat(ctx, prev.ObjectKey); errors.Is(err, storage.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return s.recordUpload(ctx, repository.CreateUploadParams{
+		ImageHash:    hash,
+		ObjectKey:    prev.ObjectKey,
+		ContentType:  prev.ContentType,
+		Size:         prev.Size,
+		Width:        prev.Width,
+		Height:       prev.Height,
+		ThumbnailKey: prev.ThumbnailKey,
+		DisplayKey:   prev.DisplayKey,
+		Uploader:     sql.NullString{String: uploader, Valid: uploader != ""},
+	})
 }
 
-func (s *ResourceService) initCosClient(ctx context.Context) error {
-	u, _ := url.Parse(fmt.Sprintf("https://%s.cos.%s.myqcloud.com", s.cfg.Cos.Bucket, s.cfg.Cos.Region))
-	b := &cos.BaseURL{BucketURL: u}
+// recordUpload 记录上传并返回原图、缩略图和展示图的下载链接
+func (s *ResourceService) recordUpload(ctx context.Context, upload repository.CreateUploadParams) (*UploadResponse, error) {
+	if err := s.db.CreateUpload(ctx, upload); err != nil {
+		return nil, err
+	}
+
+	// 获取链接
+	getPreSignedUrlCtx, span := s.tracer.Start(ctx, "getPresignedURL")
+	defer span.End()
+	var response UploadResponse
+	for _, v := range []struct {
+		key sql.NullString
+		url *string
+	}{
+		{sql.NullString{String: upload.ObjectKey, Valid: true}, &response.Url},
+		{upload.ThumbnailKey, &response.ThumbnailUrl},
+		{upload.DisplayKey, &response.DisplayUrl},
+	} {
+		if !v.key.Valid {
+			continue
+		}
+		var err error
+		if *v.url, err = s.store.PresignGet(getPreSignedUrlCtx, v.key.String, storage.PresignExpires(s.cfg.Storage)); err != nil {
+			return nil, err
+		}
+	}
+	return &response, nil
+}
 
-	authResponse, err := s.getCosAuth(ctx)
+// saveVariants 生成并保存缩略图和展示图
+func (s *ResourceService) saveVariants(ctx context.Context, data []byte, hash string) (thumbnailKey, displayKey sql.NullString, err error) {
+	src, err := imageproc.Open(data, uploadLimits(s.cfg.Upload))
 	if err != nil {
-		return err
-	}
-	client := cos.NewClient(b, &http.Client{
-		Transport: &cos.AuthorizationTransport{
-			SecretID:     authResponse.TmpSecretId,
-			SecretKey:    authResponse.TmpSecretKey,
-			SessionToken: authResponse.Token,
-		},
+		return thumbnailKey, displayKey, err
+	}
+
+	thumbnailSize, displaySize := s.cfg.Upload.ThumbnailSize, s.cfg.Upload.DisplaySize
+	if thumbnailSize <= 0 {
+		thumbnailSize = defaultThumbnailSize
+	}
+	if displaySize <= 0 {
+		displaySize = defaultDisplaySize
+	}
+
+	_, span := s.tracer.Start(ctx, "renderVariants")
+	defer span.End()
+	for _, v := range []struct {
+		name string
+		size int
+		key  *sql.NullString
+	}{
+		{"thumb", thumbnailSize, &thumbnailKey},
+		{"display", displaySize, &displayKey},
+	} {
+		result, err := src.Render(imageproc.Options{MaxDimension: v.size, JPEGQuality: s.cfg.Image.JPEGQuality})
+		if err != nil {
+			return thumbnailKey, displayKey, err
+		}
+		key := fmt.Sprintf("sha256/%s_%s%s", hash, v.name, result.Format.Ext())
+		if _, err := s.putIfAbsent(ctx, key, result.Data, result.Format); err != nil {
+			return thumbnailKey, displayKey, err
+		}
+		*v.key = sql.NullString{String: key, Valid: true}
+	}
+	return thumbnailKey, displayKey, nil
+}
+
+// putIfAbsent 对象不存在时才上传，返回对象是否已经存在
+func (s *ResourceService) putIfAbsent(ctx context.Context, key string, data []byte, format imageproc.Format) (bool, error) {
+	statCtx, span := s.tracer.Start(ctx, "stat")
+	_, err := s.store.Stat(statCtx, key)
+	span.End()
+	switch {
+	case err == nil:
+		return true, nil
+	case !errors.Is(err, storage.ErrNotFound):
+		return false, err
+	}
+
+	// 开始上传
+	uploadCtx, span := s.tracer.Start(ctx, "upload")
+	defer span.End()
+	return false, s.store.Put(uploadCtx, key, bytes.NewReader(data), storage.PutOptions{
+		ContentType: format.ContentType(),
+		Size:        int64(len(data)),
 	})
-	s.cosClient = &CosClient{
-		Client:       client,
-		tmpSecretId:  authResponse.TmpSecretId,
-		tmpSecretKey: authResponse.TmpSecretKey,
-		token:        authResponse.Token,
-		expiredTime:  authResponse.ExpiredTime,
-	}
-	return nil
+}
+
+// imageKey 原图按内容哈希存放
+func imageKey(hash string, format imageproc.Format) string {
+	return fmt.Sprintf("sha256/%s%s", hash, format.Ext())
+}
+
+func uploadMaxBytes(cfg config.Upload) int64 {
+	if cfg.MaxBytes > 0 {
+		return cfg.MaxBytes
+	}
+	return defaultUploadMaxBytes
+}
+
+// uploadLimits 上传图片和请求中直接携带的图片使用相同的尺寸限制
+func uploadLimits(cfg config.Upload) imageproc.Limits {
+	limits := imageproc.Limits{
+		MinDimension: cfg.MinDimension,
+		MaxDimension: cfg.MaxDimension,
+		MaxPixels:    cfg.MaxPixels,
+	}
+	if limits.MinDimension <= 0 {
+		limits.MinDimension = defaultUploadMinDimension
+	}
+	if limits.MaxDimension <= 0 {
+		limits.MaxDimension = defaultUploadMaxDimension
+	}
+	if limits.MaxPixels <= 0 {
+		limits.MaxPixels = defaultUploadMaxPixels
+	}
+	return limits
 }
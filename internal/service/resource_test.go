@@ -0,0 +1,127 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/fanchunke/deeppick-ai/internal/storage"
+	"github.com/labstack/echo/v4"
+)
+
+var uploadColumns = []string{
+	"id", "image_hash", "object_key", "content_type", "size", "width", "height",
+	"thumbnail_key", "display_key", "uploader", "created_at",
+}
+
+func newUploadRequest(t *testing.T, data []byte) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("note", "ignored")
+	part, err := w.CreateFormFile("image", "a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(data)
+	w.Close()
+	req := httptest.NewRequest(http.MethodPost, "/api/upload", &body)
+	req.Header.Set(echo.HeaderContentType, w.FormDataContentType())
+	return req
+}
+
+func newResourceService(t *testing.T, cfg *config.Config) (*ResourceService, storage.ObjectStore, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store, err := storage.NewLocalStore(config.Local{Root: t.TempDir(), BaseUrl: "http://localhost"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewResourceService(cfg, store, db), store, mock
+}
+
+func encodePNG(t *testing.T, size int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, size, size))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadReusesSameContent(t *testing.T) {
+	s, store, mock := newResourceService(t, &config.Config{})
+	data := encodePNG(t, 64)
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	key := "sha256/" + hash + ".png"
+	if err := store.Put(context.Background(), key, bytes.NewReader(data), storage.PutOptions{ContentType: "image/png"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 哈希在接收时计算，命中已有的上传后沿用之前的对象，不再生成缩略图和展示图
+	mock.ExpectQuery(regexp.QuoteMeta("FROM uploads\nWHERE image_hash = ?")).WithArgs(hash).
+		WillReturnRows(sqlmock.NewRows(uploadColumns).AddRow(
+			1, hash, key, "image/png", len(data), 64, 64, "sha256/thumb.jpg", nil, "u0", nil,
+		))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO uploads")).
+		WithArgs(hash, key, "image/png", int64(len(data)), int32(64), int32(64),
+			sql.NullString{String: "sha256/thumb.jpg", Valid: true}, sql.NullString{}, sql.NullString{}).
+		WillReturnResult(sqlmock.NewResult(2, 1))
+
+	rec := httptest.NewRecorder()
+	if err := s.Upload()(echo.New().NewContext(newUploadRequest(t, data), rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status code = %d, body %s", rec.Code, rec.Body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUploadRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		code int
+	}{
+		{name: "too large", data: make([]byte, 2048), code: http.StatusRequestEntityTooLarge},
+		{name: "not an image", data: []byte("not an image"), code: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, mock := newResourceService(t, &config.Config{Upload: config.Upload{MaxBytes: 1024}})
+			if tt.code == http.StatusBadRequest {
+				mock.ExpectQuery(regexp.QuoteMeta("FROM uploads")).WillReturnError(sql.ErrNoRows)
+			}
+
+			rec := httptest.NewRecorder()
+			if err := s.Upload()(echo.New().NewContext(newUploadRequest(t, tt.data), rec)); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.code {
+				t.Fatalf("status code = %d, want %d", rec.Code, tt.code)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
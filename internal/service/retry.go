@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/fanchunke/deeppick-ai/internal/imageproc"
+)
+
+// 任务失败原因分类
+const (
+	ErrCodeRateLimit       = "rate_limit"
+	ErrCodeServerError     = "server_error"
+	ErrCodeTimeout         = "timeout"
+	ErrCodeInvalidOutput   = "invalid_output"
+	ErrCodeProviderError   = "provider_error"
+	ErrCodeImageFetch      = "image_fetch"
+	ErrCodeInvalidImage    = "invalid_image"
+	ErrCodeTooManyAttempts = "too_many_attempts"
+	ErrCodeInternal        = "internal"
+)
+
+// ProviderError 视觉模型提供方返回的 HTTP 错误，由各 VisionDetector 实现转换
+type ProviderError struct {
+	StatusCode int
+	Err        error
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("provider status %d: %v", e.StatusCode, e.Err)
+}
+
+func (e *ProviderError) Unwrap() error {
+	return e.Err
+}
+
+// TaskError 记录在 tasks.last_error 中的失败原因
+type TaskError struct {
+	Code      string   `json:"code"`
+	Message   string   `json:"message"`
+	Details   []string `json:"details,omitempty"`
+	Retryable bool     `json:"retryable"`
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// classifyError 将检测过程中的错误归类
+func classifyError(err error) *TaskError {
+	var taskErr *TaskError
+	if errors.As(err, &taskErr) {
+		return taskErr
+	}
+
+	var validationErr *ValidationError
+	if errors.As(err, &validationErr) {
+		return &TaskError{Code: ErrCodeInvalidOutput, Message: "模型输出未通过校验", Details: validationErr.Violations}
+	}
+
+	code := ErrCodeInternal
+	var providerErr *ProviderError
+	var fetchErr *ImageFetchError
+	var netErr net.Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &providerErr):
+		switch {
+		case providerErr.StatusCode == http.StatusTooManyRequests:
+			code = ErrCodeRateLimit
+		case providerErr.StatusCode >= http.StatusInternalServerError:
+			code = ErrCodeServerError
+		default:
+			code = ErrCodeProviderError
+		}
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		code = ErrCodeTimeout
+	case errors.As(err, &fetchErr):
+		switch {
+		case fetchErr.StatusCode == http.StatusTooManyRequests:
+			code = ErrCodeRateLimit
+		case fetchErr.StatusCode >= http.StatusInternalServerError:
+			code = ErrCodeServerError
+		default:
+			code = ErrCodeImageFetch
+		}
+	case errors.Is(err, imageproc.ErrUnsupportedFormat), errors.Is(err, imageproc.ErrInvalidImage):
+		code = ErrCodeInvalidImage
+	case errors.Is(err, ErrEmptyCompletion), errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		code = ErrCodeInvalidOutput
+	}
+	return &TaskError{Code: code, Message: err.Error()}
+}
+
+// RetryPolicy 失败任务的重试策略
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	RetryOn        []string
+}
+
+func NewRetryPolicy(cfg config.Retry) *RetryPolicy {
+	p := &RetryPolicy{
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: cfg.InitialBackoff,
+		MaxBackoff:     cfg.MaxBackoff,
+		Multiplier:     cfg.Multiplier,
+		RetryOn:        cfg.RetryOn,
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 1
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = time.Second
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	return p
+}
+
+// ShouldRetry 判断第 attempts 次执行失败后是否还需要重试
+func (p *RetryPolicy) ShouldRetry(taskErr *TaskError, attempts int32) bool {
+	return int(attempts) < p.MaxAttempts && slices.Contains(p.RetryOn, taskErr.Code)
+}
+
+// Backoff 返回第 attempts 次执行失败后的等待时间
+func (p *RetryPolicy) Backoff(attempts int32) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(attempts-1))
+	if backoff > float64(p.MaxBackoff) {
+		return p.MaxBackoff
+	}
+	return time.Duration(backoff)
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// 任务可能由其它实例执行，订阅的同时定期查询数据库兜底
+	streamPollInterval = 2 * time.Second
+)
+
+type taskDeltaEvent struct {
+	Content string `json:"content"`
+}
+
+// StreamTask 通过 Server-Sent Events 推送任务进度。
+// status 事件携带完整的 GetTaskResponse，delta 事件携带模型输出片段；
+// 任务重试时会重新收到 running 状态，客户端应清空之前累积的片段。
+func (s *DetectionService) StreamTask() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req GetTaskRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+
+		ctx := c.Request().Context()
+		events, unsubscribe := s.events.Subscribe(req.TaskId)
+		defer unsubscribe()
+
+		task, err := s.db.GetTask(ctx, req.TaskId)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && !ownedBy(c, task.UserID)) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "task not found"})
+		}
+		if err != nil {
+			return err
+		}
+
+		w := c.Response()
+		w.Header().Set(echo.HeaderContentType, "text/event-stream")
+		w.Header().Set(echo.HeaderCacheControl, "no-cache")
+		w.Header().Set(echo.HeaderConnection, "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		if err := writeSSE(w, "status", newGetTaskResponse(task)); err != nil {
+			return nil
+		}
+		lastStatus := task.Status
+		if TaskStatus(lastStatus).Terminal() {
+			return nil
+		}
+
+		ticker := time.NewTicker(streamPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case event := <-events:
+				if event.Status == "" {
+					if err := writeSSE(w, "delta", taskDeltaEvent{Content: event.Delta}); err != nil {
+						return nil
+					}
+					continue
+				}
+			case <-ticker.C:
+				// 保持连接，防止被代理断开
+				if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+					return nil
+				}
+				w.Flush()
+			}
+
+			task, err := s.db.GetTask(ctx, req.TaskId)
+			if err != nil {
+				s.logger.Errorf("stream task %s failed: %v", req.TaskId, err)
+				continue
+			}
+			if task.Status == lastStatus {
+				continue
+			}
+			lastStatus = task.Status
+			if err := writeSSE(w, "status", newGetTaskResponse(task)); err != nil {
+				return nil
+			}
+			if TaskStatus(task.Status).Terminal() {
+				return nil
+			}
+		}
+	}
+}
+
+func writeSSE(w *echo.Response, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	w.Flush()
+	return nil
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultSyncTimeout = 30 * time.Second
+	waitPollInterval   = time.Second
+)
+
+// SyncDetectFailedResponse 同步模式下任务失败时的返回
+type SyncDetectFailedResponse struct {
+	TaskId    string     `json:"task_id"`
+	Error     string     `json:"error"`
+	LastError *TaskError `json:"last_error"`
+}
+
+// respondSync 在截止时间内等待任务结束：成功时直接返回识别结果
+// （DetectImageResponse 或 MultiDetectImageResponse），
+// 失败时返回 502 和失败原因，任务被取消时返回 409，超时则返回 202 和 task_id，由调用方继续轮询。
+// 客户端断开连接时不再返回，任务继续在后台执行。
+func (s *DetectionService) respondSync(c echo.Context, taskId string, events <-chan TaskEvent) error {
+	timeout := s.cfg.Detection.SyncTimeout
+	if timeout <= 0 {
+		timeout = defaultSyncTimeout
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+	defer cancel()
+
+	task, err := s.waitTask(ctx, taskId, events)
+	if c.Request().Context().Err() != nil {
+		return nil
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return c.JSON(http.StatusAccepted, DetectionTaskResponse{TaskId: taskId})
+	}
+	if err != nil {
+		return err
+	}
+
+	if status := TaskStatus(task.Status); status != Success {
+		// 取消是调用方的操作，不是模型调用失败
+		code := http.StatusBadGateway
+		if status == Cancelled {
+			code = http.StatusConflict
+		}
+		return c.JSON(code, SyncDetectFailedResponse{
+			TaskId:    taskId,
+			Error:     "detection " + task.Status,
+			LastError: newGetTaskResponse(task).LastError,
+		})
+	}
+
+	// 结果在写入前已经过校验，按任务的返回形式原样返回
+	return c.JSONBlob(http.StatusOK, []byte(task.Result.String))
+}
+
+// waitTask 等待任务结束，任务可能由其它实例执行，因此同时定期查询数据库
+func (s *DetectionService) waitTask(ctx context.Context, taskId string, events <-chan TaskEvent) (repository.Task, error) {
+	ticker := time.NewTicker(waitPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return repository.Task{}, ctx.Err()
+		case event := <-events:
+			if !event.Status.Terminal() {
+				continue
+			}
+		case <-ticker.C:
+		}
+
+		task, err := s.db.GetTask(ctx, taskId)
+		if err != nil {
+			return repository.Task{}, err
+		}
+		if TaskStatus(task.Status).Terminal() {
+			return task, nil
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/labstack/echo/v4"
+)
+
+func TestRespondSync(t *testing.T) {
+	tests := []struct {
+		status string
+		code   int
+	}{
+		{string(Failed), http.StatusBadGateway},
+		{string(Cancelled), http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			s := NewDetectionService(nil, nil, nil, nil, &config.Config{}, db, nil, echo.New().Logger)
+			mock.ExpectQuery(regexp.QuoteMeta("FROM tasks\nWHERE task_id = ?")).WithArgs("task-1").
+				WillReturnRows(taskRow("task-1", tt.status, ""))
+
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/api/image/detect?mode=sync", nil), rec)
+			events := make(chan TaskEvent, 1)
+			events <- TaskEvent{Status: TaskStatus(tt.status)}
+			if err := s.respondSync(c, "task-1", events); err != nil {
+				t.Fatal(err)
+			}
+			if rec.Code != tt.code {
+				t.Fatalf("status code = %d, want %d", rec.Code, tt.code)
+			}
+		})
+	}
+}
+
+func TestRespondSyncClientDisconnected(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	s := NewDetectionService(nil, nil, nil, nil, &config.Config{Detection: config.Detection{SyncTimeout: time.Minute}}, db, nil, echo.New().Logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/image/detect?mode=sync", nil).WithContext(ctx)
+	c := echo.New().NewContext(req, rec)
+	if err := s.respondSync(c, "task-1", make(chan TaskEvent)); err != nil {
+		t.Fatalf("expected no error after client disconnected, got %v", err)
+	}
+	if c.Response().Committed {
+		t.Fatal("response written after client disconnected")
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
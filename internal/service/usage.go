@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/labstack/echo/v4"
+)
+
+// PriceTable 按模型计算调用费用
+type PriceTable struct {
+	currency string
+	prices   map[string]config.ModelPrice
+}
+
+func NewPriceTable(cfg config.Pricing) *PriceTable {
+	t := &PriceTable{currency: cfg.Currency, prices: make(map[string]config.ModelPrice, len(cfg.Models))}
+	for _, p := range cfg.Models {
+		t.prices[p.Model] = p
+	}
+	return t
+}
+
+// Cost 计算一次调用的费用，价格表中没有该模型时返回 false
+func (t *PriceTable) Cost(model string, usage Usage) (float64, bool) {
+	p, ok := t.prices[model]
+	if !ok {
+		return 0, false
+	}
+	return (float64(usage.PromptTokens)*p.InputPrice + float64(usage.CompletionTokens)*p.OutputPrice) / 1e6, true
+}
+
+// recordUsage 累加任务的 token 用量和费用，写入失败不影响任务结果
+func (s *DetectionService) recordUsage(ctx context.Context, task repository.Task, result *VisionResult, latency time.Duration) {
+	// 兼容接口返回的模型名称可能为空，此时按配置的模型计价
+	model := result.Model
+	if model == "" {
+		model = s.detector.Model()
+	}
+	cost, ok := s.prices.Cost(model, result.Usage)
+	if !ok {
+		s.logger.Warnf("no price configured for model %s, cost of task %s recorded as 0", model, task.TaskID)
+	}
+	if err := s.db.AddTaskUsage(ctx, repository.AddTaskUsageParams{
+		Model:            sql.NullString{String: model, Valid: true},
+		PromptTokens:     int32(result.Usage.PromptTokens),
+		CompletionTokens: int32(result.Usage.CompletionTokens),
+		LatencyMs:        int32(latency.Milliseconds()),
+		Cost:             cost,
+		TaskID:           task.TaskID,
+	}); err != nil {
+		s.logger.Warnf("record usage of task %s failed: %v", task.TaskID, err)
+	}
+}
+
+const (
+	UsageGroupByModel = "model"
+	UsageGroupByUser  = "user"
+	UsageGroupByDay   = "day"
+)
+
+// GetUsageRequest from/to 支持 RFC3339 或 2006-01-02，只给出日期时 to 包含当天
+type GetUsageRequest struct {
+	From    string `query:"from"`
+	To      string `query:"to"`
+	GroupBy string `query:"group_by"` // model, user, day，默认 model
+}
+
+type UsageSummary struct {
+	Key              string  `json:"key"`
+	Tasks            int64   `json:"tasks"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	LatencyMs        int64   `json:"latency_ms"`
+	Cost             float64 `json:"cost"`
+}
+
+type GetUsageResponse struct {
+	GroupBy  string         `json:"group_by"`
+	Currency string         `json:"currency"`
+	Items    []UsageSummary `json:"items"`
+	Total    UsageSummary   `json:"total"`
+}
+
+// GetUsage 按模型、用户或日期汇总时间范围内创建的任务的用量和费用
+func (s *DetectionService) GetUsage() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req GetUsageRequest
+		if err := c.Bind(&req); err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		if req.GroupBy == "" {
+			req.GroupBy = UsageGroupByModel
+		}
+		from, err := parseDateParam(req.From, false)
+		if err != nil || !from.Valid {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "from is required, RFC3339 or 2006-01-02"})
+		}
+		to, err := parseDateParam(req.To, true)
+		if err != nil || !to.Valid {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": "to is required, RFC3339 or 2006-01-02"})
+		}
+
+		items, err := s.summarizeUsage(c.Request().Context(), req.GroupBy, from, to)
+		if err != nil {
+			return err
+		}
+		if items == nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": fmt.Sprintf("unknown group_by: %q", req.GroupBy)})
+		}
+
+		response := GetUsageResponse{GroupBy: req.GroupBy, Currency: s.prices.currency, Items: items}
+		for _, item := range items {
+			response.Total.Tasks += item.Tasks
+			response.Total.PromptTokens += item.PromptTokens
+			response.Total.CompletionTokens += item.CompletionTokens
+			response.Total.LatencyMs += item.LatencyMs
+			response.Total.Cost += item.Cost
+		}
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+// summarizeUsage 未知的分组方式返回 nil
+func (s *DetectionService) summarizeUsage(ctx context.Context, groupBy string, from, to sql.NullTime) ([]UsageSummary, error) {
+	items := []UsageSummary{}
+	switch groupBy {
+	case UsageGroupByModel:
+		rows, err := s.db.SummarizeUsageByModel(ctx, repository.SummarizeUsageByModelParams{CreatedFrom: from, CreatedTo: to})
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			items = append(items, UsageSummary{
+				Key:              r.GroupKey.String,
+				Tasks:            r.Tasks,
+				PromptTokens:     r.PromptTokens,
+				CompletionTokens: r.CompletionTokens,
+				LatencyMs:        r.LatencyMs,
+				Cost:             r.Cost,
+			})
+		}
+	case UsageGroupByUser:
+		rows, err := s.db.SummarizeUsageByUser(ctx, repository.SummarizeUsageByUserParams{CreatedFrom: from, CreatedTo: to})
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			items = append(items, UsageSummary{
+				Key:              r.GroupKey.String,
+				Tasks:            r.Tasks,
+				PromptTokens:     r.PromptTokens,
+				CompletionTokens: r.CompletionTokens,
+				LatencyMs:        r.LatencyMs,
+				Cost:             r.Cost,
+			})
+		}
+	case UsageGroupByDay:
+		rows, err := s.db.SummarizeUsageByDay(ctx, repository.SummarizeUsageByDayParams{CreatedFrom: from, CreatedTo: to})
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			items = append(items, UsageSummary{
+				Key:              r.GroupKey.Format(time.DateOnly),
+				Tasks:            r.Tasks,
+				PromptTokens:     r.PromptTokens,
+				CompletionTokens: r.CompletionTokens,
+				LatencyMs:        r.LatencyMs,
+				Cost:             r.Cost,
+			})
+		}
+	default:
+		return nil, nil
+	}
+	return items, nil
+}
@@ -0,0 +1,173 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	minScore = 1
+	maxScore = 10
+	// 归一化坐标允许的浮点误差
+	boxEpsilon = 1e-6
+)
+
+// ValidationError 模型输出未通过结构或取值校验
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid model output: " + strings.Join(e.Violations, "; ")
+}
+
+// validateDetectionResult 解析并校验模型输出，校验通过后才允许写入任务结果
+func validateDetectionResult(profile *DetectionProfile, mode ResponseMode, content string) error {
+	if mode == MultiResponse {
+		_, err := parseMultiDetectImageResponse(profile, content)
+		return err
+	}
+	_, err := parseDetectImageResponse(profile, content)
+	return err
+}
+
+func parseDetectImageResponse(profile *DetectionProfile, content string) (*DetectImageResponse, error) {
+	var response DetectImageResponse
+	if err := decodeStrict(content, &response); err != nil {
+		return nil, err
+	}
+	if err := validateDetectImageResponse(profile, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func parseMultiDetectImageResponse(profile *DetectionProfile, content string) (*MultiDetectImageResponse, error) {
+	var response MultiDetectImageResponse
+	if err := decodeStrict(content, &response); err != nil {
+		return nil, err
+	}
+	if err := validateMultiDetectImageResponse(profile, &response); err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+func decodeStrict(content string, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(content)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return &ValidationError{Violations: []string{fmt.Sprintf("malformed json: %v", err)}}
+	}
+	return nil
+}
+
+// validator 收集所有不合规项，一次性返回给模型修正
+type validator struct {
+	violations []string
+}
+
+func (v *validator) addf(format string, args ...interface{}) {
+	v.violations = append(v.violations, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) required(field, value string) {
+	if strings.TrimSpace(value) == "" {
+		v.addf("%s is required", field)
+	}
+}
+
+func (v *validator) score(field string, value float64) {
+	if value < minScore || value > maxScore {
+		v.addf("%s must be between %d and %d, got %v", field, minScore, maxScore, value)
+	}
+}
+
+func (v *validator) category(field string, profile *DetectionProfile, value string) {
+	if value != profile.Category {
+		v.addf("%s must be %q, got %q", field, profile.Category, value)
+	}
+}
+
+// metrics 检查指标是否与检测类型的指标集合一一对应
+func (v *validator) metrics(field string, profile *DetectionProfile, metrics []Metric) {
+	expected := make(map[string]bool, len(profile.Metrics))
+	for _, m := range profile.Metrics {
+		expected[m.Name] = false
+	}
+	for i, m := range metrics {
+		f := fmt.Sprintf("%s[%d]", field, i)
+		seen, ok := expected[m.Name]
+		switch {
+		case !ok:
+			v.addf("%s.name %q is not an expected metric", f, m.Name)
+		case seen:
+			v.addf("%s.name %q is duplicated", f, m.Name)
+		}
+		expected[m.Name] = true
+		v.required(f+".label", m.Label)
+		v.required(f+".basis", m.Basis)
+		v.score(f+".value", m.Value)
+	}
+	for _, m := range profile.Metrics {
+		if !expected[m.Name] {
+			v.addf("%s: metric %q is missing", field, m.Name)
+		}
+	}
+}
+
+func (v *validator) boundingBox(field string, box BoundingBox) {
+	inUnit := func(name string, value float64) {
+		if value < 0 || value > 1 {
+			v.addf("%s.%s must be between 0 and 1, got %v", field, name, value)
+		}
+	}
+	inUnit("x", box.X)
+	inUnit("y", box.Y)
+	inUnit("width", box.Width)
+	inUnit("height", box.Height)
+	if box.Width <= 0 || box.Height <= 0 {
+		v.addf("%s must have positive width and height", field)
+	}
+	if box.X+box.Width > 1+boxEpsilon || box.Y+box.Height > 1+boxEpsilon {
+		v.addf("%s exceeds the image", field)
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.violations) > 0 {
+		return &ValidationError{Violations: v.violations}
+	}
+	return nil
+}
+
+func validateDetectImageResponse(profile *DetectionProfile, resp *DetectImageResponse) error {
+	var v validator
+	v.required("name", resp.Name)
+	v.required("scientific_name", resp.ScientificName)
+	v.required("family", resp.Family)
+	v.required("overall_score.reason", resp.OverallScore.Reason)
+	v.required("expert_advice.storage", resp.ExpertAdvice.Storage)
+	v.required("expert_advice.nutrition", resp.ExpertAdvice.Nutrition)
+	v.required("expert_advice.selection", resp.ExpertAdvice.Selection)
+	v.score("overall_score.score", resp.OverallScore.Score)
+	v.category("category", profile, resp.Category)
+	v.metrics("metrics", profile, resp.Metrics)
+	return v.err()
+}
+
+func validateMultiDetectImageResponse(profile *DetectionProfile, resp *MultiDetectImageResponse) error {
+	var v validator
+	for i, item := range resp.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		v.required(field+".name", item.Name)
+		v.required(field+".overall_score.reason", item.OverallScore.Reason)
+		v.score(field+".overall_score.score", item.OverallScore.Score)
+		v.category(field+".category", profile, item.Category)
+		v.metrics(field+".metrics", profile, item.Metrics)
+		v.boundingBox(field+".bounding_box", item.BoundingBox)
+	}
+	return v.err()
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func fakeContent(t *testing.T, profile *DetectionProfile, mode ResponseMode) string {
+	t.Helper()
+	result, err := NewFakeDetector().Detect(context.Background(), &VisionRequest{Profile: profile, Mode: mode})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.Content
+}
+
+func TestValidateDetectImageResponse(t *testing.T) {
+	profile, err := LookupDetectionProfile(FruitDetection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := fakeContent(t, profile, SingleResponse)
+	mutate := func(fn func(*DetectImageResponse)) string {
+		var resp DetectImageResponse
+		if err := json.Unmarshal([]byte(valid), &resp); err != nil {
+			t.Fatal(err)
+		}
+		fn(&resp)
+		data, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		reject  string // 为空表示通过
+	}{
+		{name: "valid", content: valid},
+		{name: "malformed json", content: `{"name":`, reject: "malformed json"},
+		{name: "unknown field", content: strings.Replace(valid, `{`, `{"extra":1,`, 1), reject: "malformed json"},
+		{name: "trailing text is ignored", content: valid + "\n"},
+		{name: "missing name", content: mutate(func(r *DetectImageResponse) { r.Name = " " }), reject: "name is required"},
+		{name: "missing advice", content: mutate(func(r *DetectImageResponse) { r.ExpertAdvice.Storage = "" }), reject: "expert_advice.storage is required"},
+		{name: "score too low", content: mutate(func(r *DetectImageResponse) { r.OverallScore.Score = 0 }), reject: "overall_score.score must be between 1 and 10"},
+		{name: "score too high", content: mutate(func(r *DetectImageResponse) { r.OverallScore.Score = 10.5 }), reject: "overall_score.score must be between 1 and 10"},
+		{name: "wrong category", content: mutate(func(r *DetectImageResponse) { r.Category = "vegetable" }), reject: "category must be"},
+		{name: "metric value out of range", content: mutate(func(r *DetectImageResponse) { r.Metrics[0].Value = 11 }), reject: "metrics[0].value must be between"},
+		{name: "metric missing basis", content: mutate(func(r *DetectImageResponse) { r.Metrics[0].Basis = "" }), reject: "metrics[0].basis is required"},
+		{name: "unexpected metric", content: mutate(func(r *DetectImageResponse) { r.Metrics[0].Name = "unknown" }), reject: `metrics[0].name "unknown" is not an expected metric`},
+		{name: "duplicated metric", content: mutate(func(r *DetectImageResponse) { r.Metrics[1].Name = r.Metrics[0].Name }), reject: "is duplicated"},
+		{name: "missing metric", content: mutate(func(r *DetectImageResponse) { r.Metrics = r.Metrics[1:] }), reject: "is missing"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertValidation(t, validateDetectionResult(profile, SingleResponse, tt.content), tt.reject)
+		})
+	}
+}
+
+func TestValidateMultiDetectImageResponse(t *testing.T) {
+	profile, err := LookupDetectionProfile(VegetableDetection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valid := fakeContent(t, profile, MultiResponse)
+	mutate := func(fn func(*MultiDetectImageResponse)) string {
+		var resp MultiDetectImageResponse
+		if err := json.Unmarshal([]byte(valid), &resp); err != nil {
+			t.Fatal(err)
+		}
+		fn(&resp)
+		data, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		reject  string
+	}{
+		{name: "valid", content: valid},
+		{name: "no items", content: `{"items":[]}`},
+		{name: "single response in multi mode", content: fakeContent(t, profile, SingleResponse), reject: "malformed json"},
+		{name: "item missing name", content: mutate(func(r *MultiDetectImageResponse) { r.Items[1].Name = "" }), reject: "items[1].name is required"},
+		{name: "item score", content: mutate(func(r *MultiDetectImageResponse) { r.Items[0].OverallScore.Score = 0.5 }), reject: "items[0].overall_score.score must be between"},
+		{name: "item category", content: mutate(func(r *MultiDetectImageResponse) { r.Items[0].Category = "fruit" }), reject: "items[0].category must be"},
+		{name: "item metrics", content: mutate(func(r *MultiDetectImageResponse) { r.Items[0].Metrics = nil }), reject: "items[0].metrics: metric"},
+		{name: "box outside unit", content: mutate(func(r *MultiDetectImageResponse) { r.Items[0].BoundingBox.X = -0.1 }), reject: "items[0].bounding_box.x must be between 0 and 1"},
+		{name: "box empty", content: mutate(func(r *MultiDetectImageResponse) { r.Items[0].BoundingBox.Width = 0 }), reject: "items[0].bounding_box must have positive width and height"},
+		{name: "box exceeds image", content: mutate(func(r *MultiDetectImageResponse) { r.Items[1].BoundingBox.X = 0.7 }), reject: "items[1].bounding_box exceeds the image"},
+		{name: "box on the edge", content: mutate(func(r *MultiDetectImageResponse) {
+			r.Items[1].BoundingBox = BoundingBox{X: 0.6, Y: 0.6, Width: 0.4, Height: 0.4}
+		})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assertValidation(t, validateDetectionResult(profile, MultiResponse, tt.content), tt.reject)
+		})
+	}
+}
+
+func TestValidationCollectsAllViolations(t *testing.T) {
+	profile, err := LookupDetectionProfile(FruitDetection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = validateDetectionResult(profile, SingleResponse, `{"name":"","overall_score":{"score":0}}`)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected *ValidationError, got %v", err)
+	}
+	// 一次返回所有不合规项，模型可以一次修正
+	if len(validationErr.Violations) < 3 {
+		t.Fatalf("expected all violations, got %q", validationErr.Violations)
+	}
+}
+
+func assertValidation(t *testing.T, err error, reject string) {
+	t.Helper()
+	if reject == "" {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("expected *ValidationError containing %q, got %v", reject, err)
+	}
+	if !strings.Contains(validationErr.Error(), reject) {
+		t.Fatalf("expected violation containing %q, got %q", reject, validationErr.Violations)
+	}
+}
@@ -0,0 +1,278 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/fanchunke/deeppick-ai/internal/urlpolicy"
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	WebhookSignatureHeader = "X-DeepPick-Signature"
+	WebhookTimestampHeader = "X-DeepPick-Timestamp"
+	WebhookTaskIdHeader    = "X-DeepPick-Task-Id"
+
+	defaultWebhookWorkers = 4
+	webhookPollInterval   = time.Second
+)
+
+// WebhookNotifier 任务结束后将 GetTaskResponse 回调给调用方。
+// 请求体使用 HMAC-SHA256 签名，签名内容为 "<timestamp>.<body>"，
+// 每次投递结果都会记录到 webhook_deliveries 表。
+// 待投递的回调保存在 webhook_jobs 表中，由 Run 启动的 worker 领取投递，
+// 进程重启后未完成的投递和重试会继续进行。
+type WebhookNotifier struct {
+	conn    *sql.DB
+	client  *http.Client
+	policy  *urlpolicy.Policy
+	secret  []byte
+	retry   *RetryPolicy
+	workers int
+	notify  chan struct{}
+	db      *repository.Queries
+	logger  echo.Logger
+}
+
+func NewWebhookNotifier(cfg config.Webhook, conn *sql.DB, logger echo.Logger) *WebhookNotifier {
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = defaultWebhookWorkers
+	}
+	// 回调地址由调用方提交，同样需要防止访问内网；不跟随重定向
+	policy := urlpolicy.New(config.URLPolicy{
+		Hosts:        cfg.Hosts,
+		AllowPrivate: cfg.AllowPrivate,
+		MaxRedirects: -1,
+	})
+	return &WebhookNotifier{
+		conn:   conn,
+		client: policy.Client(timeout),
+		policy: policy,
+		secret: []byte(cfg.Secret),
+		retry: NewRetryPolicy(config.Retry{
+			MaxAttempts:    cfg.MaxAttempts,
+			InitialBackoff: cfg.InitialBackoff,
+			MaxBackoff:     cfg.MaxBackoff,
+		}),
+		workers: workers,
+		notify:  make(chan struct{}, 1),
+		db:      repository.New(conn),
+		logger:  logger,
+	}
+}
+
+// Enabled 是否配置了签名密钥，未配置时不接受回调，避免回调可以被伪造
+func (n *WebhookNotifier) Enabled() bool {
+	return len(n.secret) > 0
+}
+
+// Validate 校验调用方提交的回调地址
+func (n *WebhookNotifier) Validate(ctx context.Context, rawUrl string) error {
+	if !n.Enabled() {
+		return errors.New("callback_url is not supported: webhook secret is not configured")
+	}
+	if err := n.policy.Check(ctx, rawUrl); err != nil {
+		var policyErr *urlpolicy.Error
+		if errors.As(err, &policyErr) {
+			return fmt.Errorf("callback_url rejected: %s", policyErr.Reason)
+		}
+		return err
+	}
+	return nil
+}
+
+// Sign 计算回调请求的签名，回调方可以用同样的方式校验
+func (n *WebhookNotifier) Sign(timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, n.secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Enqueue 在 qtx 的事务中为已结束的任务创建回调，返回是否创建。
+// 与任务状态在同一事务中写入，事务提交后调用 Notify 唤醒 worker。
+func (n *WebhookNotifier) Enqueue(ctx context.Context, qtx *repository.Queries, task repository.Task) (bool, error) {
+	if !task.CallbackUrl.Valid || task.CallbackUrl.String == "" || !n.Enabled() {
+		return false, nil
+	}
+	if err := qtx.CreateWebhookJob(ctx, repository.CreateWebhookJobParams{TaskID: task.TaskID, Url: task.CallbackUrl.String}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Notify 唤醒一个空闲的 worker
+func (n *WebhookNotifier) Notify() {
+	select {
+	case n.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run 启动投递回调的 worker，阻塞直到 ctx 结束且所有 worker 退出
+func (n *WebhookNotifier) Run(ctx context.Context) {
+	if !n.Enabled() {
+		return
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < n.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (n *WebhookNotifier) work(ctx context.Context) {
+	for ctx.Err() == nil {
+		job, err := n.claim(ctx)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) && ctx.Err() == nil {
+				n.logger.Errorf("claim webhook job failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+			case <-n.notify:
+			case <-time.After(webhookPollInterval):
+			}
+			continue
+		}
+		n.process(ctx, job)
+	}
+}
+
+// claim 在事务中领取一个到期的回调，并把下次投递时间推迟到请求超时之后作为租约，
+// 投递期间进程退出时租约过期后由其它 worker 重新投递
+func (n *WebhookNotifier) claim(ctx context.Context) (repository.WebhookJob, error) {
+	tx, err := n.conn.BeginTx(ctx, nil)
+	if err != nil {
+		return repository.WebhookJob{}, err
+	}
+	defer tx.Rollback()
+
+	qtx := n.db.WithTx(tx)
+	job, err := qtx.GetDueWebhookJob(ctx)
+	if err != nil {
+		return repository.WebhookJob{}, err
+	}
+	if err := qtx.LeaseWebhookJob(ctx, repository.LeaseWebhookJobParams{
+		LeaseSeconds: int64(math.Ceil(2 * n.client.Timeout.Seconds())),
+		ID:           job.ID,
+	}); err != nil {
+		return repository.WebhookJob{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return repository.WebhookJob{}, err
+	}
+	job.Attempts++
+	return job, nil
+}
+
+// process 投递一次回调，成功或无法重试时删除回调，否则按退避策略安排下次投递
+func (n *WebhookNotifier) process(ctx context.Context, job repository.WebhookJob) {
+	task, err := n.db.GetTask(ctx, job.TaskID)
+	retryable := false
+	switch {
+	case err == nil:
+		var body []byte
+		if body, err = json.Marshal(newGetTaskResponse(task)); err == nil {
+			retryable = n.deliver(ctx, job.TaskID, job.Url, job.Attempts, body)
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		retryable = true
+	}
+	if err != nil {
+		n.logger.Errorf("build webhook of task %s failed: %v", job.TaskID, err)
+	}
+	if ctx.Err() != nil {
+		// 进程退出导致投递中断，租约过期后重新投递
+		return
+	}
+
+	if retryable && int(job.Attempts) < n.retry.MaxAttempts {
+		backoff := n.retry.Backoff(job.Attempts)
+		err = n.db.RescheduleWebhookJob(ctx, repository.RescheduleWebhookJobParams{
+			DelaySeconds: int64(math.Ceil(backoff.Seconds())),
+			ID:           job.ID,
+		})
+	} else {
+		err = n.db.DeleteWebhookJob(ctx, job.ID)
+	}
+	if err != nil {
+		n.logger.Errorf("update webhook job of task %s failed: %v", job.TaskID, err)
+	}
+}
+
+// deliver 投递一次回调，返回是否需要重试
+func (n *WebhookNotifier) deliver(ctx context.Context, taskId, callbackUrl string, attempt int32, body []byte) bool {
+	ctx, cancel := context.WithTimeout(ctx, n.client.Timeout)
+	defer cancel()
+
+	delivery := repository.CreateWebhookDeliveryParams{TaskID: taskId, Url: callbackUrl, Attempt: attempt}
+	start := time.Now()
+	retryable := true
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, callbackUrl, bytes.NewReader(body))
+	if err == nil {
+		timestamp := strconv.FormatInt(start.Unix(), 10)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(WebhookTimestampHeader, timestamp)
+		req.Header.Set(WebhookSignatureHeader, n.Sign(timestamp, body))
+		req.Header.Set(WebhookTaskIdHeader, taskId)
+
+		var resp *http.Response
+		resp, err = n.client.Do(req)
+		// 地址在提交后被解析到内网等不允许的地址，重试也不会成功
+		var policyErr *urlpolicy.Error
+		if errors.As(err, &policyErr) {
+			retryable = false
+		}
+		if err == nil {
+			resp.Body.Close()
+			delivery.StatusCode = sql.NullInt32{Int32: int32(resp.StatusCode), Valid: true}
+			switch {
+			case resp.StatusCode >= 200 && resp.StatusCode < 300:
+				delivery.Delivered = true
+				retryable = false
+			case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+				err = fmt.Errorf("callback response status code: %d", resp.StatusCode)
+			default:
+				err = fmt.Errorf("callback response status code: %d", resp.StatusCode)
+				retryable = false
+			}
+		}
+	} else {
+		retryable = false
+	}
+	delivery.DurationMs = int32(time.Since(start).Milliseconds())
+	if err != nil {
+		delivery.Error = sql.NullString{String: err.Error(), Valid: true}
+		n.logger.Warnf("deliver webhook of task %s attempt %d failed: %v", taskId, attempt, err)
+	}
+
+	if _, err := n.db.CreateWebhookDelivery(context.WithoutCancel(ctx), delivery); err != nil {
+		n.logger.Errorf("save webhook delivery of task %s failed: %v", taskId, err)
+	}
+	return retryable
+}
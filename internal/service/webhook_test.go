@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/fanchunke/deeppick-ai/internal/repository"
+	"github.com/labstack/echo/v4"
+)
+
+var taskColumns = []string{
+	"id", "task_id", "user_id", "status", "image_url", "image_key", "detection_type", "response_mode", "force_refresh",
+	"image_hash", "callback_url", "batch_id", "result", "result_name", "overall_score", "model",
+	"prompt_tokens", "completion_tokens", "latency_ms", "cost", "attempts", "last_error",
+	"available_at", "lease_owner", "lease_expires_at", "created_at", "updated_at",
+}
+
+func taskRow(taskId, status, callbackUrl string) *sqlmock.Rows {
+	return sqlmock.NewRows(taskColumns).AddRow(
+		1, taskId, nil, status, "https://example.com/a.jpg", nil, "fruit", "single", false,
+		nil, callbackUrl, nil, nil, nil, nil, nil,
+		0, 0, 0, 0.0, 1, nil,
+		time.Now(), nil, nil, time.Now(), time.Now(),
+	)
+}
+
+func TestWebhookJobProcess(t *testing.T) {
+	tests := []struct {
+		name       string
+		statusCode int
+		attempts   int32
+		expect     func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:       "delivered",
+			statusCode: http.StatusOK,
+			attempts:   1,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhook_jobs")).WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:       "retry after server error",
+			statusCode: http.StatusBadGateway,
+			attempts:   1,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("UPDATE webhook_jobs\nSET next_attempt_at")).WithArgs(int64(5), int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:       "give up after max attempts",
+			statusCode: http.StatusBadGateway,
+			attempts:   3,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhook_jobs")).WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:       "client error is not retried",
+			statusCode: http.StatusBadRequest,
+			attempts:   1,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(regexp.QuoteMeta("DELETE FROM webhook_jobs")).WithArgs(int64(7)).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.statusCode)
+			}))
+			defer srv.Close()
+
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			n := NewWebhookNotifier(config.Webhook{
+				Secret:         "secret",
+				MaxAttempts:    3,
+				InitialBackoff: 5 * time.Second,
+				AllowPrivate:   true,
+			}, db, echo.New().Logger)
+
+			mock.ExpectQuery(regexp.QuoteMeta("FROM tasks\nWHERE task_id = ?")).WithArgs("task-1").
+				WillReturnRows(taskRow("task-1", string(Success), srv.URL))
+			mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_deliveries")).WillReturnResult(sqlmock.NewResult(1, 1))
+			tt.expect(mock)
+
+			n.process(context.Background(), repository.WebhookJob{ID: 7, TaskID: "task-1", Url: srv.URL, Attempts: tt.attempts})
+
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestWebhookJobInterruptedOnShutdown(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	n := NewWebhookNotifier(config.Webhook{Secret: "secret", AllowPrivate: true}, db, echo.New().Logger)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mock.ExpectQuery(regexp.QuoteMeta("FROM tasks\nWHERE task_id = ?")).WithArgs("task-1").
+		WillReturnRows(taskRow("task-1", string(Success), srv.URL))
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO webhook_deliveries")).WillReturnResult(sqlmock.NewResult(1, 1))
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	// 进程退出时既不删除也不改期，租约过期后由其它实例重新投递
+	n.process(ctx, repository.WebhookJob{ID: 7, TaskID: "task-1", Url: srv.URL, Attempts: 1})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,115 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/tencentyun/cos-go-sdk-v5"
+)
+
+// CosStore 腾讯云 COS
+type CosStore struct {
+	client      *cos.Client
+	credentials *CosCredentialProvider
+}
+
+func NewCosStore(cfg config.Cos) *CosStore {
+	u, _ := url.Parse(fmt.Sprintf("https://%s.cos.%s.myqcloud.com", cfg.Bucket, cfg.Region))
+	credentials := NewCosCredentialProvider(cfg)
+	client := cos.NewClient(&cos.BaseURL{BucketURL: u}, &http.Client{
+		Transport: &cosAuthTransport{credentials: credentials, transport: http.DefaultTransport},
+	})
+	return &CosStore{client: client, credentials: credentials}
+}
+
+func (s *CosStore) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	header := &cos.ObjectPutHeaderOptions{ContentType: opts.ContentType}
+	if opts.Size >= 0 {
+		header.ContentLength = opts.Size
+	}
+	_, err := s.client.Object.Put(ctx, key, r, &cos.ObjectPutOptions{ObjectPutHeaderOptions: header})
+	return err
+}
+
+func (s *CosStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	resp, err := s.client.Object.Get(ctx, key, nil)
+	if err != nil {
+		if cos.IsNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *CosStore) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	cred, err := s.credentials.Credential(ctx)
+	if err != nil {
+		return "", err
+	}
+	opt := &cos.PresignedURLOptions{
+		Query:  &url.Values{},
+		Header: &http.Header{},
+	}
+	if cred.Token != "" {
+		opt.Query.Add("x-cos-security-token", cred.Token)
+	}
+	presignedURL, err := s.client.Object.GetPresignedURL(ctx, http.MethodGet, key, cred.SecretId, cred.SecretKey, expires, opt)
+	if err != nil {
+		return "", err
+	}
+	return presignedURL.String(), nil
+}
+
+func (s *CosStore) PresignPut(ctx context.Context, key string, expires time.Duration, opts PutOptions) (*PresignedRequest, error) {
+	cred, err := s.credentials.Credential(ctx)
+	if err != nil {
+		return nil, err
+	}
+	headers := presignedPutHeaders(opts)
+	opt := &cos.PresignedURLOptions{
+		Query:  &url.Values{},
+		Header: &http.Header{},
+	}
+	for k, v := range headers {
+		opt.Header.Set(k, v)
+	}
+	if cred.Token != "" {
+		opt.Query.Add("x-cos-security-token", cred.Token)
+	}
+	presignedURL, err := s.client.Object.GetPresignedURL(ctx, http.MethodPut, key, cred.SecretId, cred.SecretKey, expires, opt)
+	if err != nil {
+		return nil, err
+	}
+	return &PresignedRequest{Method: http.MethodPut, Url: presignedURL.String(), Headers: headers}, nil
+}
+
+func (s *CosStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.Object.Delete(ctx, key)
+	return err
+}
+
+func (s *CosStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	resp, err := s.client.Object.Head(ctx, key, nil)
+	if err != nil {
+		if cos.IsNotFoundError(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	lastModified, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &ObjectInfo{
+		Key:          key,
+		Size:         size,
+		ContentType:  resp.Header.Get("Content-Type"),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: lastModified,
+	}, nil
+}
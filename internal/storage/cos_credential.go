@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/tencentyun/cos-go-sdk-v5"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultCosRefreshSkew = 5 * time.Minute
+	cosAuthTimeout        = 10 * time.Second
+	// 获取临时密钥失败改用静态密钥后，隔一段时间再尝试获取临时密钥
+	staticFallbackTTL = 15 * time.Minute
+	// 获取临时密钥失败后，至少间隔这么久才再次请求
+	cosRefreshRetryInterval = 30 * time.Second
+)
+
+// CosCredential COS 访问凭证
+type CosCredential struct {
+	SecretId  string
+	SecretKey string
+	Token     string
+	ExpiredAt time.Time // 零值表示长期有效
+
+	issuedAt time.Time
+}
+
+// expiresWithin 凭证是否会在 d 之内过期
+func (c *CosCredential) expiresWithin(d time.Duration) bool {
+	return !c.ExpiredAt.IsZero() && time.Now().Add(d).After(c.ExpiredAt)
+}
+
+// refreshSkew 返回凭证需要提前刷新的时间，不超过有效期的一半，
+// 避免有效期短于 skew 的凭证一拿到就需要刷新
+func (c *CosCredential) refreshSkew(skew time.Duration) time.Duration {
+	if lifetime := c.ExpiredAt.Sub(c.issuedAt); !c.issuedAt.IsZero() && skew > lifetime/2 {
+		return lifetime / 2
+	}
+	return skew
+}
+
+// CosCredentialProvider 并发安全的 COS 凭证管理。
+// 临时密钥在过期前 skew 时间内由后台提前刷新，并发的刷新请求合并为一次；
+// 获取临时密钥失败时回退到配置的静态密钥。
+type CosCredentialProvider struct {
+	authUrl string
+	static  *CosCredential
+	skew    time.Duration
+	client  *http.Client
+
+	mu          sync.RWMutex
+	cred        *CosCredential
+	lastFailure time.Time // 最近一次获取临时密钥失败的时间
+	lastErr     error
+	group       singleflight.Group
+}
+
+func NewCosCredentialProvider(cfg config.Cos) *CosCredentialProvider {
+	p := &CosCredentialProvider{
+		authUrl: cfg.AuthUrl,
+		skew:    cfg.RefreshSkew,
+		client:  &http.Client{},
+	}
+	if cfg.SecretId != "" && cfg.SecretKey != "" {
+		p.static = &CosCredential{SecretId: cfg.SecretId, SecretKey: cfg.SecretKey}
+	}
+	if p.skew <= 0 {
+		p.skew = defaultCosRefreshSkew
+	}
+	return p
+}
+
+// Credential 返回当前可用的凭证，必要时等待刷新完成
+func (p *CosCredentialProvider) Credential(ctx context.Context) (*CosCredential, error) {
+	// 未配置临时密钥接口时只使用静态密钥
+	if p.authUrl == "" {
+		if p.static == nil {
+			return nil, errors.New("cos credential is not configured")
+		}
+		return p.static, nil
+	}
+
+	p.mu.RLock()
+	cred, lastFailure, lastErr := p.cred, p.lastFailure, p.lastErr
+	p.mu.RUnlock()
+	if cred != nil && !cred.expiresWithin(cred.refreshSkew(p.skew)) {
+		return cred, nil
+	}
+	// 刚刚失败过时不再请求接口，避免接口故障期间每次操作都触发一次请求
+	backoff := time.Since(lastFailure) < cosRefreshRetryInterval
+	if cred != nil && !cred.expiresWithin(0) {
+		// 即将过期但仍然有效，后台刷新，当前请求继续使用旧凭证
+		if !backoff {
+			p.group.DoChan("refresh", p.refresh(ctx))
+		}
+		return cred, nil
+	}
+	if backoff && lastErr != nil {
+		return nil, lastErr
+	}
+
+	ch := p.group.DoChan("refresh", p.refresh(ctx))
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-ch:
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		return r.Val.(*CosCredential), nil
+	}
+}
+
+func (p *CosCredentialProvider) refresh(ctx context.Context) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		// 刷新结果由多个请求共享，不能因为发起请求的 ctx 取消而中断
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cosAuthTimeout)
+		defer cancel()
+
+		cred, err := p.getCosAuth(ctx)
+		if err != nil {
+			p.mu.Lock()
+			p.lastFailure, p.lastErr = time.Now(), err
+			current := p.cred
+			p.mu.Unlock()
+			switch {
+			case current != nil && !current.expiresWithin(0):
+				return current, nil
+			case p.static != nil:
+				cred = &CosCredential{
+					SecretId:  p.static.SecretId,
+					SecretKey: p.static.SecretKey,
+					ExpiredAt: time.Now().Add(staticFallbackTTL),
+					issuedAt:  time.Now(),
+				}
+			default:
+				return nil, err
+			}
+		}
+
+		p.mu.Lock()
+		p.cred = cred
+		if err == nil {
+			p.lastFailure, p.lastErr = time.Time{}, nil
+		}
+		p.mu.Unlock()
+		return cred, nil
+	}
+}
+
+type CosAuthResponse struct {
+	TmpSecretId  string `json:"TmpSecretId"`
+	TmpSecretKey string `json:"TmpSecretKey"`
+	Token        string `json:"Token"`
+	ExpiredTime  int64  `json:"ExpiredTime"`
+}
+
+func (p *CosCredentialProvider) getCosAuth(ctx context.Context) (*CosCredential, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.authUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cos auth response status code: %d", resp.StatusCode)
+	}
+
+	var response CosAuthResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+	return &CosCredential{
+		SecretId:  response.TmpSecretId,
+		SecretKey: response.TmpSecretKey,
+		Token:     response.Token,
+		ExpiredAt: time.Unix(response.ExpiredTime, 0),
+		issuedAt:  time.Now(),
+	}, nil
+}
+
+// cosAuthTransport 每次请求时从 CosCredentialProvider 取凭证签名
+type cosAuthTransport struct {
+	credentials *CosCredentialProvider
+	transport   http.RoundTripper
+}
+
+func (t *cosAuthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	cred, err := t.credentials.Credential(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	cos.AddAuthorizationHeader(cred.SecretId, cred.SecretKey, cred.Token, req, cos.NewAuthTime(time.Hour))
+	return t.transport.RoundTrip(req)
+}
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+)
+
+func newCosAuthServer(t *testing.T, handler func(w http.ResponseWriter)) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		handler(w)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func TestCosCredentialStaticFallbackDoesNotRefreshEveryCall(t *testing.T) {
+	srv, hits := newCosAuthServer(t, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	p := NewCosCredentialProvider(config.Cos{AuthUrl: srv.URL, SecretId: "id", SecretKey: "key"})
+
+	for i := 0; i < 20; i++ {
+		cred, err := p.Credential(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cred.SecretId != "id" {
+			t.Fatalf("expected static credential, got %q", cred.SecretId)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("auth endpoint requested %d times, want 1", n)
+	}
+}
+
+func TestCosCredentialShortLivedTokenClampsSkew(t *testing.T) {
+	srv, hits := newCosAuthServer(t, func(w http.ResponseWriter) {
+		json.NewEncoder(w).Encode(CosAuthResponse{
+			TmpSecretId:  "tmp",
+			TmpSecretKey: "tmp-key",
+			Token:        "token",
+			ExpiredTime:  time.Now().Add(2 * time.Minute).Unix(),
+		})
+	})
+	// 有效期 2 分钟短于 skew，刷新时间收紧到有效期的一半
+	p := NewCosCredentialProvider(config.Cos{AuthUrl: srv.URL, RefreshSkew: 5 * time.Minute})
+
+	for i := 0; i < 20; i++ {
+		if _, err := p.Credential(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("auth endpoint requested %d times, want 1", n)
+	}
+}
+
+func TestCosCredentialBacksOffAfterFailure(t *testing.T) {
+	srv, hits := newCosAuthServer(t, func(w http.ResponseWriter) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	p := NewCosCredentialProvider(config.Cos{AuthUrl: srv.URL})
+
+	for i := 0; i < 5; i++ {
+		if _, err := p.Credential(context.Background()); err == nil {
+			t.Fatal("expected error without static credential")
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("auth endpoint requested %d times, want 1", n)
+	}
+}
@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+	"github.com/labstack/echo/v4"
+)
+
+// LocalRoutePrefix 本地存储的文件通过该路径由 Echo 提供下载
+const LocalRoutePrefix = "/files"
+
+// LocalStore 本地磁盘存储，用于本地开发和无法访问云存储的私有化部署。
+// 下载链接带有过期时间和 HMAC 签名，由 Serve 校验后返回文件。
+type LocalStore struct {
+	root    string
+	baseUrl string
+	key     []byte
+}
+
+func NewLocalStore(cfg config.Local) (*LocalStore, error) {
+	if cfg.Root == "" {
+		return nil, errors.New("storage.local.root is required")
+	}
+	if err := os.MkdirAll(cfg.Root, 0o755); err != nil {
+		return nil, err
+	}
+	key := []byte(cfg.SigningKey)
+	if len(key) == 0 {
+		// 未配置时随机生成，重启后已签发的链接失效
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+	}
+	return &LocalStore{root: cfg.Root, baseUrl: strings.TrimRight(cfg.BaseUrl, "/"), key: key}, nil
+}
+
+// path 将对象 key 转换为本地路径，拒绝跳出根目录的 key
+func (s *LocalStore) path(key string) (string, error) {
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid object key: %q", key)
+	}
+	return filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	// 先写临时文件再改名，避免读到写了一半的文件
+	f, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p)
+}
+
+func (s *LocalStore) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	if _, err := s.path(key); err != nil {
+		return "", err
+	}
+	expiresAt := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expiresAt)
+	query.Set("signature", s.sign(http.MethodGet, key, expiresAt))
+	return s.objectUrl(key, query), nil
+}
+
+func (s *LocalStore) PresignPut(ctx context.Context, key string, expires time.Duration, opts PutOptions) (*PresignedRequest, error) {
+	if _, err := s.path(key); err != nil {
+		return nil, err
+	}
+	headers := presignedPutHeaders(opts)
+	expiresAt := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", expiresAt)
+	query.Set("signature", s.sign(http.MethodPut, key, expiresAt, headers["Content-Type"], headers["Content-Length"]))
+	return &PresignedRequest{Method: http.MethodPut, Url: s.objectUrl(key, query), Headers: headers}, nil
+}
+
+func (s *LocalStore) objectUrl(key string, query url.Values) string {
+	return s.baseUrl + LocalRoutePrefix + "/" + (&url.URL{Path: key}).EscapedPath() + "?" + query.Encode()
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *LocalStore) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &ObjectInfo{
+		Key:          key,
+		Size:         fi.Size(),
+		ContentType:  contentTypeByExtension(path.Ext(key)),
+		LastModified: fi.ModTime(),
+	}, nil
+}
+
+// contentTypeByExtension 本地文件不保存 Content-Type，按扩展名推断
+func contentTypeByExtension(ext string) string {
+	if ext == ".heic" {
+		// 标准库的类型表中没有 heic
+		return "image/heic"
+	}
+	return mime.TypeByExtension(ext)
+}
+
+func (s *LocalStore) sign(parts ...string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(strings.Join(parts, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify 校验链接的有效期和签名，返回对象 key
+func (s *LocalStore) verify(c echo.Context, parts ...string) (string, error) {
+	key, err := url.PathUnescape(c.Param("*"))
+	if err != nil {
+		return "", err
+	}
+	expiresAt := c.QueryParam("expires")
+	expires, err := strconv.ParseInt(expiresAt, 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return "", errors.New("link expired")
+	}
+	signed := append([]string{c.Request().Method, key, expiresAt}, parts...)
+	if !hmac.Equal([]byte(c.QueryParam("signature")), []byte(s.sign(signed...))) {
+		return "", errors.New("invalid signature")
+	}
+	return key, nil
+}
+
+// Serve 校验签名和有效期后返回文件，挂载在 GET LocalRoutePrefix + "/*" 上
+func (s *LocalStore) Serve() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		key, err := s.verify(c)
+		if err != nil {
+			return c.JSON(http.StatusForbidden, echo.Map{"error": err.Error()})
+		}
+		p, err := s.path(key)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		return c.File(p)
+	}
+}
+
+// Receive 接收客户端直传的文件，挂载在 PUT LocalRoutePrefix + "/*" 上。
+// Content-Type 和 Content-Length 必须与签发时一致。
+func (s *LocalStore) Receive() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		contentType := req.Header.Get(echo.HeaderContentType)
+		key, err := s.verify(c, contentType, strconv.FormatInt(req.ContentLength, 10))
+		if err != nil {
+			return c.JSON(http.StatusForbidden, echo.Map{"error": err.Error()})
+		}
+		body := http.MaxBytesReader(c.Response(), req.Body, req.ContentLength)
+		if err := s.Put(req.Context(), key, body, PutOptions{ContentType: contentType, Size: req.ContentLength}); err != nil {
+			return err
+		}
+		return c.NoContent(http.StatusOK)
+	}
+}
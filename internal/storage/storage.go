@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+)
+
+const defaultPresignExpires = time.Hour
+
+var ErrNotFound = errors.New("object not found")
+
+// PutOptions 上传对象时的附加信息
+type PutOptions struct {
+	ContentType string
+	Size        int64 // 未知时为 -1
+}
+
+// ObjectInfo 对象的元信息
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+// PresignedRequest 客户端直传对象存储时使用的预签名请求
+type PresignedRequest struct {
+	Method  string            `json:"method"`
+	Url     string            `json:"url"`
+	Headers map[string]string `json:"headers"` // 客户端必须原样携带的请求头，已参与签名
+}
+
+// ObjectStore 对象存储，屏蔽 COS、S3 兼容存储和本地磁盘的差异
+type ObjectStore interface {
+	Put(ctx context.Context, key string, r io.Reader, opts PutOptions) error
+	// Get 读取对象内容，对象不存在时返回 ErrNotFound，调用方负责关闭
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// PresignGet 返回在 expires 内有效的下载链接
+	PresignGet(ctx context.Context, key string, expires time.Duration) (string, error)
+	// PresignPut 返回客户端直传的预签名请求，Content-Type 和 Content-Length 参与签名，上传时不能更改
+	PresignPut(ctx context.Context, key string, expires time.Duration, opts PutOptions) (*PresignedRequest, error)
+	Delete(ctx context.Context, key string) error
+	// Stat 查询对象元信息，对象不存在时返回 ErrNotFound
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+}
+
+func presignedPutHeaders(opts PutOptions) map[string]string {
+	return map[string]string{
+		"Content-Type":   opts.ContentType,
+		"Content-Length": strconv.FormatInt(opts.Size, 10),
+	}
+}
+
+// New 根据 [storage] 配置创建对象存储
+func New(cfg *config.Config) (ObjectStore, error) {
+	switch cfg.Storage.Backend {
+	case "", "cos":
+		return NewCosStore(cfg.Cos), nil
+	case "s3":
+		return NewS3Store(cfg.Storage.S3)
+	case "local":
+		return NewLocalStore(cfg.Storage.Local)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %q", cfg.Storage.Backend)
+	}
+}
+
+// PresignExpires 返回配置的下载链接有效期
+func PresignExpires(cfg config.Storage) time.Duration {
+	if cfg.PresignExpires > 0 {
+		return cfg.PresignExpires
+	}
+	return defaultPresignExpires
+}
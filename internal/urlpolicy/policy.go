@@ -0,0 +1,221 @@
+package urlpolicy
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/fanchunke/deeppick-ai/internal/config"
+)
+
+const (
+	defaultMaxRedirects     = 3
+	defaultMaxContentLength = 20 << 20
+)
+
+var (
+	defaultSchemes      = []string{"http", "https"}
+	defaultContentTypes = []string{"image/jpeg", "image/png", "image/webp"}
+	// netip 的 IsPrivate 等方法不包含的保留地址段
+	blockedPrefixes = []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/8"),     // 本网络，部分系统上等同于本机
+		netip.MustParsePrefix("100.64.0.0/10"), // 运营商级 NAT
+		netip.MustParsePrefix("64:ff9b::/96"),  // NAT64，可以映射到任意 IPv4 地址
+	}
+)
+
+// Error 图片地址未通过校验的原因
+type Error struct {
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return "image_url rejected: " + e.Reason
+}
+
+func reject(format string, args ...any) error {
+	return &Error{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Policy 限制服务端可以访问的图片地址，防止通过 image_url 访问内网（SSRF）
+type Policy struct {
+	schemes          []string
+	hosts            []string
+	allowPrivate     bool
+	maxRedirects     int
+	maxContentLength int64
+	contentTypes     []string
+	resolver         *net.Resolver
+}
+
+func New(cfg config.URLPolicy) *Policy {
+	p := &Policy{
+		schemes:          cfg.Schemes,
+		hosts:            cfg.Hosts,
+		allowPrivate:     cfg.AllowPrivate,
+		maxRedirects:     cfg.MaxRedirects,
+		maxContentLength: cfg.MaxContentLength,
+		contentTypes:     cfg.ContentTypes,
+		resolver:         net.DefaultResolver,
+	}
+	if len(p.schemes) == 0 {
+		p.schemes = defaultSchemes
+	}
+	if p.maxRedirects < 0 {
+		p.maxRedirects = 0
+	} else if p.maxRedirects == 0 {
+		p.maxRedirects = defaultMaxRedirects
+	}
+	if p.maxContentLength <= 0 {
+		p.maxContentLength = defaultMaxContentLength
+	}
+	if len(p.contentTypes) == 0 {
+		p.contentTypes = defaultContentTypes
+	}
+	return p
+}
+
+// MaxContentLength 允许下载的最大字节数
+func (p *Policy) MaxContentLength() int64 {
+	return p.maxContentLength
+}
+
+// Check 校验地址的协议和域名，并解析域名确认不指向内网地址
+func (p *Policy) Check(ctx context.Context, rawUrl string) error {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return reject("invalid url: %v", err)
+	}
+	return p.checkURL(ctx, u)
+}
+
+func (p *Policy) checkURL(ctx context.Context, u *url.URL) error {
+	if !slices.Contains(p.schemes, strings.ToLower(u.Scheme)) {
+		return reject("scheme %q is not allowed", u.Scheme)
+	}
+	if u.User != nil {
+		return reject("userinfo is not allowed")
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return reject("host is required")
+	}
+	if !p.hostAllowed(host) {
+		return reject("host %q is not allowed", host)
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return p.checkAddr(addr)
+	}
+	addrs, err := p.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return reject("resolve host %q: %v", host, err)
+	}
+	for _, addr := range addrs {
+		if err := p.checkAddr(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hostAllowed 未配置白名单时允许所有域名；"*.example.com" 匹配所有子域名，不匹配 example.com 本身
+func (p *Policy) hostAllowed(host string) bool {
+	if len(p.hosts) == 0 {
+		return true
+	}
+	for _, pattern := range p.hosts {
+		pattern = strings.ToLower(pattern)
+		if strings.HasPrefix(pattern, "*.") {
+			// 保留开头的点，按域名边界匹配，*.example.com 不会匹配 evilexample.com
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) checkAddr(addr netip.Addr) error {
+	if p.allowPrivate {
+		return nil
+	}
+	addr = addr.Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() {
+		return reject("address %s is not allowed", addr)
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return reject("address %s is not allowed", addr)
+		}
+	}
+	return nil
+}
+
+// CheckResponse 校验响应的 Content-Type 和 Content-Length
+func (p *Policy) CheckResponse(resp *http.Response) error {
+	if resp.ContentLength > p.maxContentLength {
+		return reject("content length %d exceeds %d bytes", resp.ContentLength, p.maxContentLength)
+	}
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil {
+		return reject("invalid content type %q", resp.Header.Get("Content-Type"))
+	}
+	if !slices.Contains(p.contentTypes, strings.ToLower(mediaType)) {
+		return reject("content type %q is not allowed", mediaType)
+	}
+	return nil
+}
+
+// Client 返回遵守该策略的 HTTP 客户端。
+// 建立连接时再次检查实际连接的 IP，避免 DNS 重绑定绕过 Check；每次重定向都会重新校验。
+func (p *Policy) Client(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: p.control,
+	}
+	transport := &http.Transport{
+		// 不走环境变量中的代理，否则连接检查的是代理地址
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > p.maxRedirects {
+				return reject("stopped after %d redirects", p.maxRedirects)
+			}
+			return p.checkURL(req.Context(), req.URL)
+		},
+	}
+}
+
+// control 在建立连接前检查实际连接的 IP
+func (p *Policy) control(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return reject("invalid address %q", host)
+	}
+	return p.checkAddr(addr)
+}
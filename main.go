@@ -11,15 +11,17 @@ import (
 	"os/signal"
 	"time"
 
+	"github.com/fanchunke/deeppick-ai/internal/auth"
 	"github.com/fanchunke/deeppick-ai/internal/config"
 	"github.com/fanchunke/deeppick-ai/internal/otel"
+	"github.com/fanchunke/deeppick-ai/internal/queue"
+	"github.com/fanchunke/deeppick-ai/internal/ratelimit"
+	"github.com/fanchunke/deeppick-ai/internal/repository"
 	"github.com/fanchunke/deeppick-ai/internal/service"
+	"github.com/fanchunke/deeppick-ai/internal/storage"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"github.com/openai/openai-go"
-	"github.com/openai/openai-go/option"
-	"github.com/panjf2000/ants/v2"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/labstack/echo/otelecho"
 )
 
@@ -60,28 +62,80 @@ func main() {
 	}
 	defer db.Close()
 
-	// 初始化协程池
-	pool, err := ants.NewPool(10, ants.WithPreAlloc(true))
-	if err != nil {
-		log.Fatalf("init ants pool error: %v", err)
-	}
-	defer pool.Release()
-
 	e := echo.New()
 	e.Use(middleware.Recover())
 	e.Use(middleware.Logger())
 	e.Use(otelecho.Middleware(cfg.Otel.ServiceName))
 
-	openaiClient := openai.NewClient(option.WithBaseURL(cfg.OpenAI.BaseUrl), option.WithAPIKey(cfg.OpenAI.ApiKey))
-	detectionSrv := service.NewChatCompletionService(openaiClient, cfg, db, pool, e.Logger)
-	resourceSrv := service.NewResourceService(cfg)
-	e.POST("/api/image/detect", detectionSrv.DetectImage())
-	e.POST("/api/image/upload", resourceSrv.Upload())
-	e.GET("/api/task/result", detectionSrv.GetTask())
+	detector, err := service.NewVisionDetector(cfg)
+	if err != nil {
+		log.Fatalf("init vision detector error: %v", err)
+	}
+	// 初始化任务队列
+	taskQueue := queue.New(db, cfg.Queue, e.Logger)
+	resultCache, err := service.NewResultCache(cfg.Cache, repository.New(db))
+	if err != nil {
+		log.Fatalf("init result cache error: %v", err)
+	}
+	store, err := storage.New(cfg)
+	if err != nil {
+		log.Fatalf("init object store error: %v", err)
+	}
+	if local, ok := store.(*storage.LocalStore); ok {
+		e.GET(storage.LocalRoutePrefix+"/*", local.Serve())
+		e.PUT(storage.LocalRoutePrefix+"/*", local.Receive())
+	}
+	authenticator, err := auth.NewAuthenticator(cfg.Auth)
+	if err != nil {
+		log.Fatalf("init authenticator error: %v", err)
+	}
+	wechatClient, err := auth.NewWeChatClient(cfg.WeChat)
+	if err != nil {
+		log.Fatalf("init wechat client error: %v", err)
+	}
+	authSrv := service.NewAuthService(authenticator, wechatClient)
+	limiter, err := ratelimit.New(cfg.RateLimit)
+	if err != nil {
+		log.Fatalf("init rate limiter error: %v", err)
+	}
+	resourceSrv := service.NewResourceService(cfg, store, db)
+	detectionSrv := service.NewDetectionService(detector, resultCache, resourceSrv, limiter, cfg, db, taskQueue, e.Logger)
+	e.POST("/api/auth/wechat/login", authSrv.WeChatLogin(), limiter.Middleware())
+
+	// 以下接口需要 API Key 或登录 token
+	api := e.Group("/api", authenticator.Middleware())
+	api.POST("/image/detect", detectionSrv.DetectImage(), limiter.Middleware())
+	api.POST("/image/detect/batch", detectionSrv.DetectImageBatch(), limiter.Middleware())
+	api.POST("/image/upload", resourceSrv.Upload())
+	api.POST("/image/upload-ticket", resourceSrv.UploadTicket())
+	api.POST("/image/upload-complete", resourceSrv.UploadComplete())
+	api.GET("/tasks", detectionSrv.ListTasks())
+	api.GET("/task/result", detectionSrv.GetTask())
+	api.POST("/task/cancel", detectionSrv.CancelTask())
+	api.GET("/task/stream", detectionSrv.StreamTask())
+	api.GET("/batch/result", detectionSrv.GetBatch())
+
+	admin := api.Group("/admin", auth.RequireAdmin())
+	admin.GET("/usage", detectionSrv.GetUsage())
 
 	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
 	defer stop()
 
+	if dbCache, ok := resultCache.(*service.DBCache); ok {
+		go dbCache.Run(ctx, e.Logger)
+	}
+
+	queueDone := make(chan struct{})
+	go func() {
+		defer close(queueDone)
+		taskQueue.Run(ctx, detectionSrv.ProcessTask)
+	}()
+	webhookDone := make(chan struct{})
+	go func() {
+		defer close(webhookDone)
+		detectionSrv.RunWebhooks(ctx)
+	}()
+
 	go func() {
 		if err := e.Start(fmt.Sprintf(":%d", cfg.HTTP.Port)); err != nil && err != http.ErrServerClosed {
 			e.Logger.Fatal("shutting down the server")
@@ -95,4 +149,6 @@ func main() {
 	if err := e.Shutdown(ctx); err != nil {
 		e.Logger.Fatal(err)
 	}
+	<-queueDone
+	<-webhookDone
 }